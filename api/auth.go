@@ -0,0 +1,289 @@
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// authenticator validates the bearer tokens of API requests; nil when authentication is disabled
+	authenticator *Authenticator
+	// allowedOrigins lists the browser origins allowed to call the API cross-origin
+	allowedOrigins []string
+)
+
+// Authenticator validates JWTs and maps their subject to a wallet identity
+type Authenticator struct {
+	hmacKeys map[string]interface{}
+	rsaKeys  map[string]interface{}
+	methods  []string
+	issuer   string
+	audience string
+	subjects map[string]string
+}
+
+// jwks is a JSON Web Key Set
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		K   string `json:"k"`
+	} `json:"keys"`
+}
+
+// NewAuthenticator loads the verification keys described by the configuration
+func NewAuthenticator(cfg AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{
+		hmacKeys: make(map[string]interface{}),
+		rsaKeys:  make(map[string]interface{}),
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		subjects: cfg.Subjects,
+	}
+
+	if cfg.HS256Secret != "" {
+		a.hmacKeys[""] = []byte(cfg.HS256Secret)
+	}
+
+	for kid, path := range cfg.RS256PublicKeys {
+		keyPEM, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key %s: %w", kid, err)
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key %s: %w", kid, err)
+		}
+		a.rsaKeys[kid] = key
+	}
+
+	if cfg.JWKSFile != "" {
+		if err := a.loadJWKS(cfg.JWKSFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(a.hmacKeys) > 0 {
+		a.methods = append(a.methods, jwt.SigningMethodHS256.Alg())
+	}
+	if len(a.rsaKeys) > 0 {
+		a.methods = append(a.methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(a.methods) == 0 {
+		return nil, errors.New("no JWT verification keys configured")
+	}
+
+	return a, nil
+}
+
+// loadJWKS adds the RSA and symmetric keys of a local JWKS file
+func (a *Authenticator) loadJWKS(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+
+	var set jwks
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("failed to parse JWKS file: %w", err)
+	}
+
+	for _, key := range set.Keys {
+		switch key.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(key.N)
+			e, errE := base64.RawURLEncoding.DecodeString(key.E)
+			if errN != nil || errE != nil {
+				return fmt.Errorf("JWKS key %q has an invalid modulus or exponent", key.Kid)
+			}
+			a.rsaKeys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "oct":
+			k, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil {
+				return fmt.Errorf("JWKS key %q has an invalid value", key.Kid)
+			}
+			a.hmacKeys[key.Kid] = k
+		default:
+			return fmt.Errorf("JWKS key %q has unsupported type %q", key.Kid, key.Kty)
+		}
+	}
+
+	return nil
+}
+
+// keyFunc returns the key that verifies the token, chosen by its algorithm and kid header.
+// A token without a kid is accepted only when a single key of its algorithm is configured.
+func (a *Authenticator) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return selectKey(a.hmacKeys, kid)
+	case jwt.SigningMethodRS256.Alg():
+		return selectKey(a.rsaKeys, kid)
+	}
+	return nil, fmt.Errorf("unsupported signing method %s", token.Method.Alg())
+}
+
+// selectKey returns the key with the given kid, or the only key when the token has no kid
+func selectKey(keys map[string]interface{}, kid string) (interface{}, error) {
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no verification key for kid %q", kid)
+}
+
+// Authenticate validates the token and returns the organization and user of the wallet identity its
+// subject maps to: the identity configured for the subject under auth.subjects, else the subject
+// itself read as <user>@<org>
+func (a *Authenticator) Authenticate(tokenString string) (org, user string, err error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(a.methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if a.issuer != "" {
+		options = append(options, jwt.WithIssuer(a.issuer))
+	}
+	if a.audience != "" {
+		options = append(options, jwt.WithAudience(a.audience))
+	}
+
+	var claims jwt.RegisteredClaims
+	if _, err := jwt.ParseWithClaims(tokenString, &claims, a.keyFunc, options...); err != nil {
+		return "", "", err
+	}
+
+	label := claims.Subject
+	if mapped, ok := a.subjects[claims.Subject]; ok {
+		label = mapped
+	}
+
+	i := strings.LastIndex(label, "@")
+	if i <= 0 || i == len(label)-1 {
+		return "", "", fmt.Errorf("subject %q does not map to a wallet identity", claims.Subject)
+	}
+	return label[i+1:], label[:i], nil
+}
+
+// bearerToken returns the token of the Authorization header. Browsers cannot set headers on
+// EventSource and WebSocket requests, so the event streams also accept an access_token query parameter.
+func bearerToken(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	if strings.Contains(c.FullPath(), "/events/") {
+		return c.Query("access_token")
+	}
+	return ""
+}
+
+// redactedLogFormatter formats request log lines like gin's default logger, with the value of an
+// access_token query parameter replaced, so event stream tokens never end up in the logs
+func redactedLogFormatter(param gin.LogFormatterParams) string {
+	if i := strings.Index(param.Path, "?"); i >= 0 {
+		if query, err := url.ParseQuery(param.Path[i+1:]); err != nil {
+			param.Path = param.Path[:i] + "?<unparsable query>"
+		} else if query.Has("access_token") {
+			query.Set("access_token", "REDACTED")
+			param.Path = param.Path[:i+1] + query.Encode()
+		}
+	}
+
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		param.Path,
+		param.ErrorMessage,
+	)
+}
+
+// authenticateRequest resolves the organization and user a request acts as from its bearer token.
+// The route prefix and X-Fabric-Org/X-Fabric-User headers, when given, must name the same identity.
+func authenticateRequest(c *gin.Context, org, user string) (string, string, bool) {
+	token := bearerToken(c)
+	if token == "" {
+		c.Header("WWW-Authenticate", "Bearer")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "a bearer token is required"})
+		return "", "", false
+	}
+
+	tokenOrg, tokenUser, err := authenticator.Authenticate(token)
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("invalid token: %v", err)})
+		return "", "", false
+	}
+
+	if (org != "" && org != tokenOrg) || (user != "" && user != tokenUser) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("token for %s of %s may not act as another identity", tokenUser, tokenOrg)})
+		return "", "", false
+	}
+
+	return tokenOrg, tokenUser, true
+}
+
+// corsMiddleware allows cross-origin requests from the allowed origins only
+func corsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin != "" && originAllowed(origin) {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Fabric-Org, X-Fabric-User, X-API-Key")
+			c.Header("Vary", "Origin")
+		}
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(204)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// originAllowed reports whether a WebSocket handshake comes from an allowed origin. Clients that
+// send no Origin header are not browsers and are allowed.
+func originAllowed(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
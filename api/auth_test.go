@@ -0,0 +1,260 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testHS256Secret = "test-secret"
+
+// hs256Token signs a token for the subject with the test secret, valid for an hour
+func hs256Token(t *testing.T, subject string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   subject,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte(testHS256Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// writeJWKS writes a JWKS file holding the RSA public key under kid
+func writeJWKS(t *testing.T, kid string, key *rsa.PublicKey) string {
+	t.Helper()
+	set := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// signToken signs the claims with the method and key, naming kid in the header when it is not empty
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestAuthenticate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs256, err := NewAuthenticator(AuthConfig{HS256Secret: testHS256Secret, Subjects: map[string]string{"auth0|42": "alice@Org1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs256, err := NewAuthenticator(AuthConfig{JWKSFile: writeJWKS(t, "key1", &rsaKey.PublicKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := func(subject string) jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{Subject: subject, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+	}
+
+	tests := []struct {
+		name          string
+		authenticator *Authenticator
+		token         string
+		org, user     string
+	}{
+		{
+			name:          "HS256 token",
+			authenticator: hs256,
+			token:         signToken(t, jwt.SigningMethodHS256, []byte(testHS256Secret), "", valid("alice@Org1")),
+			org:           "Org1", user: "alice",
+		},
+		{
+			name:          "mapped subject",
+			authenticator: hs256,
+			token:         signToken(t, jwt.SigningMethodHS256, []byte(testHS256Secret), "", valid("auth0|42")),
+			org:           "Org1", user: "alice",
+		},
+		{
+			name:          "RS256 token with a JWKS kid",
+			authenticator: rs256,
+			token:         signToken(t, jwt.SigningMethodRS256, rsaKey, "key1", valid("bob@Org2")),
+			org:           "Org2", user: "bob",
+		},
+		{
+			name:          "expired token",
+			authenticator: hs256,
+			token: signToken(t, jwt.SigningMethodHS256, []byte(testHS256Secret), "", jwt.RegisteredClaims{
+				Subject: "alice@Org1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+			}),
+		},
+		{
+			name:          "token without exp",
+			authenticator: hs256,
+			token:         signToken(t, jwt.SigningMethodHS256, []byte(testHS256Secret), "", jwt.RegisteredClaims{Subject: "alice@Org1"}),
+		},
+		{
+			name:          "HS256 token for an RS256 configuration",
+			authenticator: rs256,
+			token:         signToken(t, jwt.SigningMethodHS256, []byte(testHS256Secret), "key1", valid("bob@Org2")),
+		},
+		{
+			name:          "HS256 token signed with the RSA public key",
+			authenticator: rs256,
+			token:         signToken(t, jwt.SigningMethodHS256, rsaKey.PublicKey.N.Bytes(), "key1", valid("bob@Org2")),
+		},
+		{
+			name:          "alg none",
+			authenticator: hs256,
+			token:         signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", valid("alice@Org1")),
+		},
+		{
+			name:          "unknown JWKS kid",
+			authenticator: rs256,
+			token:         signToken(t, jwt.SigningMethodRS256, rsaKey, "key2", valid("bob@Org2")),
+		},
+		{
+			name:          "wrong secret",
+			authenticator: hs256,
+			token:         signToken(t, jwt.SigningMethodHS256, []byte("another-secret"), "", valid("alice@Org1")),
+		},
+		{
+			name:          "unmapped subject",
+			authenticator: hs256,
+			token:         signToken(t, jwt.SigningMethodHS256, []byte(testHS256Secret), "", valid("auth0|43")),
+		},
+		{
+			name:          "subject without an organization",
+			authenticator: hs256,
+			token:         signToken(t, jwt.SigningMethodHS256, []byte(testHS256Secret), "", valid("alice@")),
+		},
+	}
+
+	for _, tt := range tests {
+		org, user, err := tt.authenticator.Authenticate(tt.token)
+		if tt.org == "" {
+			if err == nil {
+				t.Errorf("%s: expected the token to be rejected, got %s of %s", tt.name, user, org)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if org != tt.org || user != tt.user {
+			t.Errorf("%s: expected %s of %s, got %s of %s", tt.name, tt.user, tt.org, user, org)
+		}
+	}
+}
+
+func TestAuthenticateRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	auth, err := NewAuthenticator(AuthConfig{HS256Secret: testHS256Secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := authenticator
+	authenticator = auth
+	t.Cleanup(func() { authenticator = previous })
+
+	router := gin.New()
+	handler := func(c *gin.Context) {
+		org, user, ok := authenticateRequest(c, c.Param("org"), c.GetHeader(userHeader))
+		if ok {
+			c.String(http.StatusOK, user+"@"+org)
+		}
+	}
+	router.GET("/api/v1/assets", handler)
+	router.GET("/api/v1/orgs/:org/assets", handler)
+	router.GET("/api/v1/events/stream", handler)
+
+	token := hs256Token(t, "alice@Org1")
+	tests := []struct {
+		name     string
+		path     string
+		header   string
+		user     string
+		expected int
+	}{
+		{name: "bearer header", path: "/api/v1/assets", header: "Bearer " + token, expected: http.StatusOK},
+		{name: "matching org and user", path: "/api/v1/orgs/Org1/assets", header: "Bearer " + token, user: "alice", expected: http.StatusOK},
+		{name: "no token", path: "/api/v1/assets", expected: http.StatusUnauthorized},
+		{name: "not a bearer token", path: "/api/v1/assets", header: "Basic " + token, expected: http.StatusUnauthorized},
+		{name: "other org", path: "/api/v1/orgs/Org2/assets", header: "Bearer " + token, expected: http.StatusForbidden},
+		{name: "other user", path: "/api/v1/assets", header: "Bearer " + token, user: "bob", expected: http.StatusForbidden},
+		{name: "access_token on an event stream", path: "/api/v1/events/stream?access_token=" + token, expected: http.StatusOK},
+		{name: "access_token on another route", path: "/api/v1/assets?access_token=" + token, expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		if tt.user != "" {
+			r.Header.Set(userHeader, tt.user)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.expected, w.Code, w.Body)
+		}
+		if w.Code == http.StatusOK && w.Body.String() != "alice@Org1" {
+			t.Errorf("%s: expected alice@Org1, got %s", tt.name, w.Body)
+		}
+	}
+}
+
+func TestRedactedLogFormatter(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/api/v1/events/blocks?access_token=secret.jwt.value", "/api/v1/events/blocks?access_token=REDACTED"},
+		{"/api/v1/events/blocks?start=5&access_token=secret.jwt.value", "/api/v1/events/blocks?access_token=REDACTED&start=5"},
+		{"/api/v1/assets?pageSize=10", "/api/v1/assets?pageSize=10"},
+		{"/api/v1/assets", "/api/v1/assets"},
+	}
+
+	for _, tt := range tests {
+		line := redactedLogFormatter(gin.LogFormatterParams{Path: tt.path, Method: "GET", StatusCode: 200})
+		if strings.Contains(line, "secret") {
+			t.Errorf("%s: token was logged: %s", tt.path, line)
+		}
+		if !strings.Contains(line, tt.expected) {
+			t.Errorf("%s: expected %s in %s", tt.path, tt.expected, line)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// CAClient talks to the REST API of a Fabric CA server
+type CAClient struct {
+	url        string
+	caName     string
+	registrar  RegistrarConfig
+	httpClient *http.Client
+
+	// registrarID is the registrar's enrolled identity. It is kept out of the wallet, so that requests
+	// cannot select the registrar as an identity to transact as.
+	mu          sync.Mutex
+	registrarID *WalletIdentity
+}
+
+// RegistrationRequest describes a user to register with the CA
+type RegistrationRequest struct {
+	EnrollmentID   string        `json:"id"`
+	Type           string        `json:"type,omitempty"`
+	Secret         string        `json:"secret,omitempty"`
+	Affiliation    string        `json:"affiliation,omitempty"`
+	MaxEnrollments int           `json:"max_enrollments,omitempty"`
+	Attributes     []CAAttribute `json:"attrs,omitempty"`
+	CAName         string        `json:"caname,omitempty"`
+}
+
+// CAAttribute is an attribute assigned to a registered user. Attributes with ECert set are added to
+// the user's enrollment certificates.
+type CAAttribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	ECert bool   `json:"ecert,omitempty"`
+}
+
+// caResponse is the envelope of every Fabric CA REST response
+type caResponse struct {
+	Success bool            `json:"success"`
+	Result  json.RawMessage `json:"result"`
+	Errors  []caMessage     `json:"errors"`
+}
+
+// caMessage is an error reported by the CA
+type caMessage struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewCAClient creates a client of the CA described by the configuration. An https URL is verified
+// against the configured TLS CA certificate; an http URL, such as a local stub CA, uses no TLS.
+func NewCAClient(cfg CAConfig) (*CAClient, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if strings.HasPrefix(cfg.URL, "https://") {
+		certificate, err := loadCertificate(cfg.TLSCACerts.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load CA TLS certificate: %w", err)
+		}
+		certPool := x509.NewCertPool()
+		certPool.AddCert(certificate)
+		transport.TLSClientConfig = &tls.Config{RootCAs: certPool}
+	}
+
+	return &CAClient{
+		url:        strings.TrimSuffix(cfg.URL, "/"),
+		caName:     cfg.CAName,
+		registrar:  cfg.Registrar,
+		httpClient: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// RegistrarIdentity returns the registrar's identity, enrolling the registrar on first use
+func (ca *CAClient) RegistrarIdentity(mspID string) (*WalletIdentity, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if ca.registrarID == nil {
+		id, err := ca.Enroll(mspID, ca.registrar.EnrollID, ca.registrar.EnrollSecret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to enroll registrar: %v", err)
+		}
+		ca.registrarID = id
+	}
+
+	return ca.registrarID, nil
+}
+
+// Register registers a user on behalf of the registrar and returns the user's enrollment secret
+func (ca *CAClient) Register(registrar *WalletIdentity, request RegistrationRequest) (string, error) {
+	request.CAName = ca.caName
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := ca.authToken(registrar, http.MethodPost, "/api/v1/register", body)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Secret string `json:"secret"`
+	}
+	if err := ca.post("/api/v1/register", body, func(req *http.Request) { req.Header.Set("Authorization", token) }, &result); err != nil {
+		return "", fmt.Errorf("failed to register %s: %w", request.EnrollmentID, err)
+	}
+
+	return result.Secret, nil
+}
+
+// Enroll generates a key pair for the user, has the CA sign a certificate for it and returns the
+// resulting wallet identity
+func (ca *CAClient) Enroll(mspID, enrollmentID, secret string) (*WalletIdentity, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %w", err)
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: enrollmentID},
+	}, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate request: %w", err)
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"certificate_request": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		"caname":              ca.caName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Cert string `json:"Cert"`
+	}
+	if err := ca.post("/api/v1/enroll", body, func(req *http.Request) { req.SetBasicAuth(enrollmentID, secret) }, &result); err != nil {
+		return nil, fmt.Errorf("failed to enroll %s: %w", enrollmentID, err)
+	}
+
+	certificatePEM, err := base64.StdEncoding.DecodeString(result.Cert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode enrollment certificate: %w", err)
+	}
+	privateKeyPEM, err := identity.PrivateKeyToPEM(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWalletIdentity(mspID, certificatePEM, privateKeyPEM), nil
+}
+
+// authToken builds the Fabric CA token that authenticates a request as the registrar: the
+// base64 certificate and a signature over the method, URI, body and certificate
+func (ca *CAClient) authToken(registrar *WalletIdentity, method, uri string, body []byte) (string, error) {
+	encodedCert := base64.StdEncoding.EncodeToString([]byte(registrar.Credentials.Certificate))
+	payload := method + "." + base64.StdEncoding.EncodeToString([]byte(uri)) + "." +
+		base64.StdEncoding.EncodeToString(body) + "." + encodedCert
+
+	sign, err := registrar.newSign()
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256([]byte(payload))
+	signature, err := sign(digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign CA request: %w", err)
+	}
+
+	return encodedCert + "." + base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// post sends a JSON request to the CA and decodes the result of a successful response
+func (ca *CAClient) post(uri string, body []byte, authorize func(*http.Request), result interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, ca.url+uri, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	authorize(req)
+
+	resp, err := ca.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("CA request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read CA response: %w", err)
+	}
+
+	var response caResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return fmt.Errorf("CA returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	if !response.Success {
+		if len(response.Errors) > 0 {
+			return fmt.Errorf("CA error %d: %s", response.Errors[0].Code, response.Errors[0].Message)
+		}
+		return fmt.Errorf("CA returned %s", resp.Status)
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
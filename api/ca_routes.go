@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// certificateAuthorities holds the CA client of every organization that configures one
+var certificateAuthorities = map[string]*CAClient{}
+
+// RegisterUserRequest represents the request body for registering a user with the organization's CA
+type RegisterUserRequest struct {
+	EnrollmentID   string        `json:"enrollmentId" binding:"required"`
+	Secret         string        `json:"secret"`
+	Type           string        `json:"type"`
+	Affiliation    string        `json:"affiliation"`
+	MaxEnrollments int           `json:"maxEnrollments"`
+	Attributes     []CAAttribute `json:"attributes"`
+}
+
+// EnrollUserRequest represents the request body for enrolling a registered user
+type EnrollUserRequest struct {
+	Secret string `json:"secret" binding:"required"`
+}
+
+// requireOrgAdmin only lets requests acting as an organization's Admin identity through
+func requireOrgAdmin(c *gin.Context) {
+	setup := requestGateway(c)
+	if setup.UserName != defaultUserName {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("only %s of %s may manage identities", defaultUserName, setup.OrgName)})
+		return
+	}
+	c.Next()
+}
+
+// organizationCA returns the CA client of the request's organization
+func organizationCA(c *gin.Context) (*CAClient, bool) {
+	setup := requestGateway(c)
+	ca, ok := certificateAuthorities[setup.OrgName]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("organization %s has no certificate authority configured", setup.OrgName)})
+	}
+	return ca, ok
+}
+
+// reservedIdentity reports why user may not be enrolled into or removed from the wallet of the
+// organization: the configured Admin and the CA registrar cannot be replaced, removed or used to
+// transact through the API. Labels are compared case-insensitively, as they name files on
+// case-insensitive file systems too.
+func reservedIdentity(org, user string) (string, bool) {
+	if strings.EqualFold(user, defaultUserName) {
+		return fmt.Sprintf("%s is configured in config.yaml and cannot be replaced or removed", defaultUserName), true
+	}
+	if ca, ok := certificateAuthorities[org]; ok && strings.EqualFold(user, ca.registrar.EnrollID) {
+		return fmt.Sprintf("%s is the CA registrar of %s and cannot be used as a transacting identity", user, org), true
+	}
+	return "", false
+}
+
+// registerUser registers a user with the organization's CA and returns the enrollment secret
+func registerUser(c *gin.Context) {
+	var req RegisterUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ca, ok := organizationCA(c)
+	if !ok {
+		return
+	}
+	setup := requestGateway(c)
+
+	registrar, err := ca.RegistrarIdentity(setup.MSPID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Type == "" {
+		req.Type = "client"
+	}
+	secret, err := ca.Register(registrar, RegistrationRequest{
+		EnrollmentID:   req.EnrollmentID,
+		Type:           req.Type,
+		Secret:         req.Secret,
+		Affiliation:    req.Affiliation,
+		MaxEnrollments: req.MaxEnrollments,
+		Attributes:     req.Attributes,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"enrollmentId": req.EnrollmentID, "secret": secret})
+}
+
+// enrollUser enrolls a registered user with the organization's CA and stores the resulting
+// identity in the wallet, so requests can transact as that user
+func enrollUser(c *gin.Context) {
+	enrollmentID := c.Param("enrollmentId")
+
+	var req EnrollUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	setup := requestGateway(c)
+	if reason, reserved := reservedIdentity(setup.OrgName, enrollmentID); reserved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": reason})
+		return
+	}
+
+	ca, ok := organizationCA(c)
+	if !ok {
+		return
+	}
+
+	id, err := ca.Enroll(setup.MSPID, enrollmentID, req.Secret)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := gateways.wallet.Put(walletLabel(setup.OrgName, enrollmentID), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// A re-enrolled user transacts with the new certificate from now on
+	gateways.Disconnect(setup.OrgName, enrollmentID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"user":        enrollmentID,
+		"mspId":       id.MSPID,
+		"certificate": id.Credentials.Certificate,
+	})
+}
+
+// listIdentities lists the users of the request's organization held in the wallet
+func listIdentities(c *gin.Context) {
+	setup := requestGateway(c)
+
+	labels, err := gateways.wallet.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	users := []string{}
+	suffix := walletLabel(setup.OrgName, "")
+	for _, label := range labels {
+		if strings.HasSuffix(label, suffix) {
+			users = append(users, strings.TrimSuffix(label, suffix))
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"organization": setup.OrgName, "users": users})
+}
+
+// removeIdentity deletes a user of the request's organization from the wallet
+func removeIdentity(c *gin.Context) {
+	setup := requestGateway(c)
+	user := c.Param("user")
+	if reason, reserved := reservedIdentity(setup.OrgName, user); reserved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": reason})
+		return
+	}
+
+	err := gateways.wallet.Remove(walletLabel(setup.OrgName, user))
+	if errors.Is(err, errIdentityNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	gateways.Disconnect(setup.OrgName, user)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Identity removed successfully"})
+}
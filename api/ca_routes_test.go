@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fabric-api/internal/stubca"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newCARouter serves the identity routes of Org1 against a stub CA, acting as the Admin of Org1
+func newCARouter(t *testing.T) (*gin.Engine, *InMemoryWallet) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	ca, err := stubca.New("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.AddRegistrar("registrar", "registrarpw")
+	server := httptest.NewServer(ca.Handler())
+	t.Cleanup(server.Close)
+
+	client, err := NewCAClient(CAConfig{
+		URL:       server.URL,
+		Registrar: RegistrarConfig{EnrollID: "registrar", EnrollSecret: "registrarpw"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallet := NewInMemoryWallet()
+	previousGateways, previousCAs := gateways, certificateAuthorities
+	gateways = NewGatewayRegistry("Org1", wallet, ConnectionConfig{})
+	certificateAuthorities = map[string]*CAClient{"Org1": client}
+	t.Cleanup(func() {
+		gateways, certificateAuthorities = previousGateways, previousCAs
+	})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(gatewayContextKey, &OrgSetup{OrgName: "Org1", UserName: defaultUserName, MSPID: "Org1MSP"})
+	})
+	admin := router.Group("/admin", requireOrgAdmin)
+	admin.POST("/users", registerUser)
+	admin.POST("/users/:enrollmentId/enroll", enrollUser)
+	admin.DELETE("/identities/:user", removeIdentity)
+
+	return router, wallet
+}
+
+// postJSON sends body to the router and returns the recorded response
+func postJSON(t *testing.T, router *gin.Engine, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload)))
+	return w
+}
+
+func TestRegisterAndEnrollUser(t *testing.T) {
+	router, wallet := newCARouter(t)
+
+	w := postJSON(t, router, "/admin/users", RegisterUserRequest{EnrollmentID: "alice", Secret: "alicepw"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: expected %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+
+	w = postJSON(t, router, "/admin/users/alice/enroll", EnrollUserRequest{Secret: "alicepw"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("enroll: expected %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+
+	id, err := wallet.Get(walletLabel("Org1", "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.MSPID != "Org1MSP" {
+		t.Fatalf("expected an Org1MSP identity, got %s", id.MSPID)
+	}
+
+	// The registrar enrolled to register alice, but it is not an identity requests can select
+	labels, err := wallet.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 1 {
+		t.Fatalf("expected only alice in the wallet, got %v", labels)
+	}
+}
+
+func TestEnrollUserRejectsReservedLabels(t *testing.T) {
+	router, wallet := newCARouter(t)
+
+	for _, user := range []string{"Admin", "admin", "ADMIN", "registrar", "Registrar"} {
+		w := postJSON(t, router, "/admin/users/"+user+"/enroll", EnrollUserRequest{Secret: "registrarpw"})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected %d, got %d: %s", user, http.StatusBadRequest, w.Code, w.Body)
+		}
+	}
+
+	labels, err := wallet.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 0 {
+		t.Fatalf("expected an empty wallet, got %v", labels)
+	}
+}
+
+func TestRemoveIdentityRejectsReservedLabels(t *testing.T) {
+	router, wallet := newCARouter(t)
+	for _, user := range []string{"Admin", "admin", "registrar", "REGISTRAR", "alice"} {
+		if err := wallet.Put(walletLabel("Org1", user), &WalletIdentity{MSPID: "Org1MSP"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, user := range []string{"Admin", "admin", "registrar", "REGISTRAR"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/admin/identities/"+user, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected %d, got %d: %s", user, http.StatusBadRequest, w.Code, w.Body)
+		}
+		if _, err := wallet.Get(walletLabel("Org1", user)); err != nil {
+			t.Errorf("%s was removed from the wallet: %v", user, err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/admin/identities/alice", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("alice: expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	if _, err := wallet.Get(walletLabel("Org1", "alice")); !errors.Is(err, errIdentityNotFound) {
+		t.Fatalf("expected alice to be removed, got %v", err)
+	}
+}
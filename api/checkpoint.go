@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Checkpoint records how far a listener has processed the ledger.
+// BlockNumber is the block to resume from; TransactionID is the last transaction processed
+// within that block, or empty when none of it has been processed yet.
+type Checkpoint struct {
+	BlockNumber   uint64 `json:"blockNumber"`
+	TransactionID string `json:"transactionId,omitempty"`
+}
+
+// FileCheckpointer persists a Checkpoint as a JSON file so that listening survives restarts
+type FileCheckpointer struct {
+	mu         sync.Mutex
+	path       string
+	checkpoint *Checkpoint
+}
+
+// NewFileCheckpointer loads the checkpoint stored at path, if any
+func NewFileCheckpointer(path string) (*FileCheckpointer, error) {
+	checkpointer := &FileCheckpointer{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpointer, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint file: %w", err)
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint file %s: %w", path, err)
+	}
+	checkpointer.checkpoint = &checkpoint
+
+	return checkpointer, nil
+}
+
+// Checkpoint returns the stored checkpoint, or nil when nothing has been processed yet
+func (c *FileCheckpointer) Checkpoint() *Checkpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.checkpoint == nil {
+		return nil
+	}
+	checkpoint := *c.checkpoint
+	return &checkpoint
+}
+
+// CheckpointTransaction records that the given transaction of the block has been processed
+func (c *FileCheckpointer) CheckpointTransaction(blockNumber uint64, transactionID string) error {
+	return c.save(Checkpoint{BlockNumber: blockNumber, TransactionID: transactionID})
+}
+
+// CheckpointBlock records that the whole block has been processed, so listening resumes at the next one
+func (c *FileCheckpointer) CheckpointBlock(blockNumber uint64) error {
+	return c.save(Checkpoint{BlockNumber: blockNumber + 1})
+}
+
+// save writes the checkpoint to a temporary file and renames it into place, so a crash never
+// leaves a partially written checkpoint behind
+func (c *FileCheckpointer) save(checkpoint Checkpoint) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write checkpoint file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync checkpoint file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close checkpoint file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to replace checkpoint file: %w", err)
+	}
+
+	c.checkpoint = &checkpoint
+	return nil
+}
@@ -0,0 +1,35 @@
+// Command stub-ca serves the register and enroll endpoints of the Fabric CA REST API, enough to try the
+// API's identity management without running a Fabric CA. It signs certificates with a generated CA key,
+// or with an organization's CA certificate and key so that the peers accept the enrolled identities.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"fabric-api/internal/stubca"
+)
+
+func main() {
+	addr := flag.String("addr", ":7054", "address to listen on")
+	registrar := flag.String("registrar", "admin:adminpw", "bootstrap registrar as id:secret")
+	caCertPath := flag.String("ca-cert", "", "PEM CA certificate to sign with (generated if empty)")
+	caKeyPath := flag.String("ca-key", "", "PEM private key of -ca-cert")
+	flag.Parse()
+
+	ca, err := stubca.New(*caCertPath, *caKeyPath)
+	if err != nil {
+		log.Fatalf("Failed to set up CA: %v", err)
+	}
+
+	id, secret, ok := strings.Cut(*registrar, ":")
+	if !ok {
+		log.Fatalf("-registrar must be id:secret")
+	}
+	ca.AddRegistrar(id, secret)
+
+	log.Printf("Stub CA listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, ca.Handler()))
+}
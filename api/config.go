@@ -0,0 +1,580 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the API configuration, read from config.yaml and overridden by environment variables
+type Config struct {
+	Version       string                        `yaml:"version"`
+	Client        ClientConfig                  `yaml:"client"`
+	Server        ServerConfig                  `yaml:"server"`
+	Storage       StorageConfig                 `yaml:"storage"`
+	Wallet        WalletConfig                  `yaml:"wallet"`
+	Auth          AuthConfig                    `yaml:"auth"`
+	Retry         RetryConfig                   `yaml:"retry"`
+	Timeouts      TimeoutConfig                 `yaml:"timeouts"`
+	Connection    ConnectionConfig              `yaml:"connection"`
+	Tracing       TracingConfig                 `yaml:"tracing"`
+	Organizations map[string]OrganizationConfig `yaml:"organizations"`
+	Peers         map[string]EndpointConfig     `yaml:"peers"`
+	Channels      map[string]ChannelConfig      `yaml:"channels"`
+}
+
+// ClientConfig selects the organization the API acts for and the chaincode it calls
+type ClientConfig struct {
+	Organization string `yaml:"organization"`
+	Channel      string `yaml:"channel"`
+	Chaincode    string `yaml:"chaincode"`
+}
+
+// ServerConfig configures the HTTP server. AllowedOrigins lists the browser origins allowed to call
+// the API cross-origin; "*" allows any origin. ShutdownTimeout bounds how long in-flight requests
+// may take to finish when the API is stopped.
+type ServerConfig struct {
+	Port            string        `yaml:"port"`
+	AllowedOrigins  []string      `yaml:"allowedOrigins"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+}
+
+// ConnectionConfig controls the gRPC connections to the gateway peers. Every peer listed for an
+// organization is checked at HealthCheckInterval; a lost connection is retried after ReconnectBaseDelay,
+// backing off up to ReconnectMaxDelay, and each attempt may take ConnectTimeout.
+type ConnectionConfig struct {
+	HealthCheckInterval time.Duration `yaml:"healthCheckInterval"`
+	ConnectTimeout      time.Duration `yaml:"connectTimeout"`
+	ReconnectBaseDelay  time.Duration `yaml:"reconnectBaseDelay"`
+	ReconnectMaxDelay   time.Duration `yaml:"reconnectMaxDelay"`
+}
+
+// TracingConfig selects where OpenTelemetry traces are exported: nowhere (none), to an OTLP collector
+// over gRPC (otlp) or as JSON lines to stdout or File (stdout). An empty Endpoint leaves the collector
+// address to the standard OTEL_EXPORTER_OTLP_* variables. SampleRatio is the share of new traces
+// recorded, 1 when unset and 0 to record none; requests carrying a sampled traceparent are always recorded.
+type TracingConfig struct {
+	Exporter    string   `yaml:"exporter"`
+	Endpoint    string   `yaml:"endpoint"`
+	Insecure    bool     `yaml:"insecure"`
+	File        string   `yaml:"file"`
+	ServiceName string   `yaml:"serviceName"`
+	SampleRatio *float64 `yaml:"sampleRatio"`
+}
+
+// AuthConfig configures JWT authentication. Tokens are verified with the HS256 secret, the RS256
+// public keys (PEM files by kid) or the keys of a local JWKS file. A token's subject is mapped to a
+// wallet identity through Subjects, or read as <user>@<org>. Disabled turns authentication off
+// and is meant for local development only.
+type AuthConfig struct {
+	Disabled        bool              `yaml:"disabled"`
+	HS256Secret     string            `yaml:"hs256Secret"`
+	RS256PublicKeys map[string]string `yaml:"rs256PublicKeys"`
+	JWKSFile        string            `yaml:"jwksFile"`
+	Issuer          string            `yaml:"issuer"`
+	Audience        string            `yaml:"audience"`
+	Subjects        map[string]string `yaml:"subjects"`
+}
+
+// RetryConfig controls how transactions invalidated by an MVCC read conflict or phantom read are
+// endorsed and submitted again. MaxAttempts counts the first attempt, so 1 disables retries. The delay
+// before each retry starts at InitialBackoff and grows by Multiplier up to MaxBackoff.
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+	Multiplier     float64       `yaml:"multiplier"`
+}
+
+// TimeoutConfig bounds the gateway calls made for a request. Routes overrides the defaults for single
+// routes, keyed by method and path below /api/v1 as registered, for example "POST /assets/:id/transfer".
+type TimeoutConfig struct {
+	CallTimeouts `yaml:",inline"`
+	Routes       map[string]CallTimeouts `yaml:"routes"`
+}
+
+// CallTimeouts bounds each step of a gateway call; a zero value takes the default
+type CallTimeouts struct {
+	Evaluate     time.Duration `yaml:"evaluate"`
+	Endorse      time.Duration `yaml:"endorse"`
+	Submit       time.Duration `yaml:"submit"`
+	CommitStatus time.Duration `yaml:"commitStatus"`
+}
+
+// StorageConfig locates the files the API keeps between restarts
+type StorageConfig struct {
+	CheckpointFile string `yaml:"checkpointFile"`
+	IndexerDB      string `yaml:"indexerDatabase"`
+}
+
+// WalletConfig selects where identities enrolled through the API are kept: in a directory
+// (filesystem) or only for the lifetime of the process (memory)
+type WalletConfig struct {
+	Type string `yaml:"type"`
+	Path string `yaml:"path"`
+}
+
+// defaultUserName names the identity configured directly on an organization
+const defaultUserName = "Admin"
+
+// OrganizationConfig describes an organization and the identities the API transacts with for it.
+// The identity configured inline is the organization's default, named Admin; Users adds more.
+type OrganizationConfig struct {
+	MSPID      string `yaml:"mspid"`
+	UserConfig `yaml:",inline"`
+	Users      map[string]UserConfig `yaml:"users"`
+	Peers      []string              `yaml:"peers"`
+	CA         *CAConfig             `yaml:"certificateAuthority"`
+}
+
+// CAConfig describes the Fabric CA of an organization and the registrar that registers its users
+type CAConfig struct {
+	URL        string          `yaml:"url"`
+	CAName     string          `yaml:"caName"`
+	TLSCACerts TLSConfig       `yaml:"tlsCACerts"`
+	Registrar  RegistrarConfig `yaml:"registrar"`
+}
+
+// RegistrarConfig holds the enrollment ID and secret of a CA identity allowed to register users
+type RegistrarConfig struct {
+	EnrollID     string `yaml:"enrollId"`
+	EnrollSecret string `yaml:"enrollSecret"`
+}
+
+// UserConfig locates an identity's credentials. CryptoPath is the identity's MSP directory;
+// CertPath and KeyPath default to its signcerts and keystore. When APIKey is set, requests
+// selecting the identity must present it in the X-API-Key header.
+type UserConfig struct {
+	CryptoPath string `yaml:"cryptoPath"`
+	CertPath   string `yaml:"certPath"`
+	KeyPath    string `yaml:"keyPath"`
+	APIKey     string `yaml:"apiKey"`
+}
+
+// identities returns every identity of the organization by name, including the default one
+func (org OrganizationConfig) identities() map[string]UserConfig {
+	identities := map[string]UserConfig{defaultUserName: org.UserConfig}
+	for name, user := range org.Users {
+		identities[name] = user
+	}
+	return identities
+}
+
+// EndpointConfig describes how to reach a peer
+type EndpointConfig struct {
+	URL         string            `yaml:"url"`
+	TLSCACerts  TLSConfig         `yaml:"tlsCACerts"`
+	GRPCOptions map[string]string `yaml:"grpcOptions"`
+}
+
+// TLSConfig locates the CA certificate that signed an endpoint's TLS certificate
+type TLSConfig struct {
+	Path string `yaml:"path"`
+}
+
+// ChannelConfig lists the peers of a channel. The gateway peers find the orderers through the channel
+// configuration, so they are not configured here.
+type ChannelConfig struct {
+	Peers map[string]ChannelPeerConfig `yaml:"peers"`
+}
+
+// ChannelPeerConfig describes the roles a peer plays on a channel
+type ChannelPeerConfig struct {
+	EndorsingPeer  bool `yaml:"endorsingPeer"`
+	ChaincodeQuery bool `yaml:"chaincodeQuery"`
+	LedgerQuery    bool `yaml:"ledgerQuery"`
+	EventSource    bool `yaml:"eventSource"`
+}
+
+// configFilePath returns the config file to load: CONFIG_FILE, else config.yaml in FABRIC_CONFIG_PATH,
+// else config.yaml in the working directory
+func configFilePath() string {
+	if file := os.Getenv("CONFIG_FILE"); file != "" {
+		return file
+	}
+	if dir := os.Getenv("FABRIC_CONFIG_PATH"); dir != "" {
+		return filepath.Join(dir, "config.yaml")
+	}
+	return "config.yaml"
+}
+
+// LoadConfig reads the config file, applies defaults and environment overrides and validates the result
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	cfg.applyDefaults()
+	cfg.applyEnvOverrides()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration in %s:\n%w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// applyDefaults fills in settings the config file may leave out
+func (cfg *Config) applyDefaults() {
+	if cfg.Client.Channel == "" {
+		cfg.Client.Channel = "mychannel"
+	}
+	if cfg.Client.Chaincode == "" {
+		cfg.Client.Chaincode = "basic"
+	}
+	if cfg.Server.Port == "" {
+		cfg.Server.Port = "8080"
+	}
+	if cfg.Server.ShutdownTimeout == 0 {
+		cfg.Server.ShutdownTimeout = 30 * time.Second
+	}
+	if cfg.Connection.HealthCheckInterval == 0 {
+		cfg.Connection.HealthCheckInterval = 5 * time.Second
+	}
+	if cfg.Connection.ConnectTimeout == 0 {
+		cfg.Connection.ConnectTimeout = 5 * time.Second
+	}
+	if cfg.Connection.ReconnectBaseDelay == 0 {
+		cfg.Connection.ReconnectBaseDelay = time.Second
+	}
+	if cfg.Connection.ReconnectMaxDelay == 0 {
+		cfg.Connection.ReconnectMaxDelay = 30 * time.Second
+	}
+	if cfg.Storage.CheckpointFile == "" {
+		cfg.Storage.CheckpointFile = "data/block-checkpoint.json"
+	}
+	if cfg.Storage.IndexerDB == "" {
+		cfg.Storage.IndexerDB = "data/indexer.db"
+	}
+	if cfg.Wallet.Type == "" {
+		cfg.Wallet.Type = "filesystem"
+	}
+	if cfg.Wallet.Path == "" {
+		cfg.Wallet.Path = "data/wallet"
+	}
+	if cfg.Retry.MaxAttempts == 0 {
+		cfg.Retry.MaxAttempts = 1
+	}
+	if cfg.Retry.InitialBackoff == 0 {
+		cfg.Retry.InitialBackoff = 100 * time.Millisecond
+	}
+	if cfg.Retry.MaxBackoff == 0 {
+		cfg.Retry.MaxBackoff = 2 * time.Second
+	}
+	if cfg.Retry.Multiplier == 0 {
+		cfg.Retry.Multiplier = 2
+	}
+	if cfg.Tracing.Exporter == "" {
+		cfg.Tracing.Exporter = "none"
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "fabric-api"
+	}
+	if cfg.Tracing.SampleRatio == nil {
+		sampleRatio := 1.0
+		cfg.Tracing.SampleRatio = &sampleRatio
+	}
+	cfg.Timeouts.CallTimeouts = cfg.Timeouts.CallTimeouts.withDefaults(CallTimeouts{
+		Evaluate:     5 * time.Second,
+		Endorse:      15 * time.Second,
+		Submit:       5 * time.Second,
+		CommitStatus: time.Minute,
+	})
+	for route, timeouts := range cfg.Timeouts.Routes {
+		cfg.Timeouts.Routes[route] = timeouts.withDefaults(cfg.Timeouts.CallTimeouts)
+	}
+}
+
+// applyEnvOverrides lets environment variables replace config file settings. Organization and
+// peer overrides apply to the client organization and its gateway peer.
+func (cfg *Config) applyEnvOverrides() {
+	setFromEnv(&cfg.Client.Organization, "FABRIC_ORGANIZATION")
+	setFromEnv(&cfg.Client.Channel, "FABRIC_CHANNEL")
+	setFromEnv(&cfg.Client.Chaincode, "FABRIC_CHAINCODE")
+	setFromEnv(&cfg.Server.Port, "PORT")
+	setFromEnv(&cfg.Storage.CheckpointFile, "CHECKPOINT_FILE")
+	setFromEnv(&cfg.Storage.IndexerDB, "INDEXER_DB")
+	setFromEnv(&cfg.Wallet.Type, "WALLET_TYPE")
+	setFromEnv(&cfg.Wallet.Path, "WALLET_PATH")
+	setFromEnv(&cfg.Auth.HS256Secret, "JWT_HS256_SECRET")
+	setFromEnv(&cfg.Auth.JWKSFile, "JWT_JWKS_FILE")
+	setFromEnv(&cfg.Auth.Issuer, "JWT_ISSUER")
+	setFromEnv(&cfg.Auth.Audience, "JWT_AUDIENCE")
+	if disabled := os.Getenv("AUTH_DISABLED"); disabled != "" {
+		cfg.Auth.Disabled = disabled == "true"
+	}
+	if origins := os.Getenv("CORS_ALLOWED_ORIGINS"); origins != "" {
+		cfg.Server.AllowedOrigins = strings.Split(origins, ",")
+	}
+	if attempts, err := strconv.Atoi(os.Getenv("RETRY_MAX_ATTEMPTS")); err == nil {
+		cfg.Retry.MaxAttempts = attempts
+	}
+	setFromEnv(&cfg.Tracing.Exporter, "TRACING_EXPORTER")
+	setFromEnv(&cfg.Tracing.File, "TRACING_FILE")
+
+	if org, ok := cfg.Organizations[cfg.Client.Organization]; ok {
+		setFromEnv(&org.MSPID, "FABRIC_MSPID")
+		setFromEnv(&org.CryptoPath, "FABRIC_CRYPTO_PATH")
+		setFromEnv(&org.CertPath, "FABRIC_CERT_PATH")
+		setFromEnv(&org.KeyPath, "FABRIC_KEY_PATH")
+		cfg.Organizations[cfg.Client.Organization] = org
+
+		if len(org.Peers) > 0 {
+			if peer, ok := cfg.Peers[org.Peers[0]]; ok {
+				setFromEnv(&peer.URL, "FABRIC_PEER_URL")
+				setFromEnv(&peer.TLSCACerts.Path, "FABRIC_PEER_TLS_CA_CERT")
+				if override := os.Getenv("FABRIC_PEER_HOST_OVERRIDE"); override != "" {
+					if peer.GRPCOptions == nil {
+						peer.GRPCOptions = make(map[string]string)
+					}
+					peer.GRPCOptions["ssl-target-name-override"] = override
+				}
+				cfg.Peers[org.Peers[0]] = peer
+			}
+		}
+	}
+}
+
+// setFromEnv replaces target with the value of the environment variable, if it is set
+func setFromEnv(target *string, name string) {
+	if value, ok := os.LookupEnv(name); ok && value != "" {
+		*target = value
+	}
+}
+
+// Validate checks that the configuration is complete and that the files it refers to exist,
+// reporting every problem found rather than only the first
+func (cfg *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if cfg.Client.Organization == "" {
+		fail("client.organization must be set")
+	}
+	if cfg.Wallet.Type != "filesystem" && cfg.Wallet.Type != "memory" {
+		fail("wallet.type must be filesystem or memory, not %q", cfg.Wallet.Type)
+	}
+	if !cfg.Auth.Disabled {
+		if cfg.Auth.HS256Secret == "" && len(cfg.Auth.RS256PublicKeys) == 0 && cfg.Auth.JWKSFile == "" {
+			fail("auth needs hs256Secret, rs256PublicKeys or jwksFile, or disabled: true for local development")
+		}
+		if cfg.Auth.HS256Secret != "" && len(cfg.Auth.HS256Secret) < 32 {
+			fail("auth.hs256Secret must be at least 32 characters")
+		}
+		for kid, path := range cfg.Auth.RS256PublicKeys {
+			checkFile(fail, "auth.rs256PublicKeys."+kid, path)
+		}
+		if cfg.Auth.JWKSFile != "" {
+			checkFile(fail, "auth.jwksFile", cfg.Auth.JWKSFile)
+		}
+	}
+	if cfg.Retry.MaxAttempts < 1 {
+		fail("retry.maxAttempts must be at least 1")
+	}
+	if cfg.Retry.Multiplier < 1 {
+		fail("retry.multiplier must be at least 1")
+	}
+	if cfg.Retry.InitialBackoff < 0 || cfg.Retry.MaxBackoff < cfg.Retry.InitialBackoff {
+		fail("retry.maxBackoff must not be less than retry.initialBackoff")
+	}
+	if cfg.Tracing.Exporter != "none" && cfg.Tracing.Exporter != "otlp" && cfg.Tracing.Exporter != "stdout" {
+		fail("tracing.exporter must be none, otlp or stdout, not %q", cfg.Tracing.Exporter)
+	}
+	if ratio := cfg.Tracing.SampleRatio; ratio != nil && (*ratio < 0 || *ratio > 1) {
+		fail("tracing.sampleRatio must be between 0 and 1")
+	}
+	for route := range cfg.Timeouts.Routes {
+		if method, path, ok := strings.Cut(route, " "); !ok || method == "" || !strings.HasPrefix(path, "/") {
+			fail("timeouts.routes: %q must have the form \"<METHOD> /<path>\"", route)
+		}
+	}
+	if len(cfg.Channels) > 0 {
+		if _, ok := cfg.Channels[cfg.Client.Channel]; !ok {
+			fail("client.channel %q is not defined under channels", cfg.Client.Channel)
+		}
+	}
+
+	for name, org := range cfg.Organizations {
+		if org.MSPID == "" {
+			fail("organizations.%s.mspid must be set", name)
+		}
+		for userName, user := range org.identities() {
+			setting := "organizations." + name
+			if userName != defaultUserName {
+				setting += ".users." + userName
+			}
+			if user.CryptoPath == "" && (user.CertPath == "" || user.KeyPath == "") {
+				fail("%s needs cryptoPath, or both certPath and keyPath", setting)
+				continue
+			}
+			checkFile(fail, "certificate of "+setting, user.certPath())
+			checkFile(fail, "keystore of "+setting, user.keyPath())
+		}
+		if len(org.Peers) == 0 {
+			fail("organizations.%s.peers must list at least one peer", name)
+		}
+		for _, peerName := range org.Peers {
+			if _, ok := cfg.Peers[peerName]; !ok {
+				fail("organizations.%s refers to peer %q, which is not defined under peers", name, peerName)
+			} else if strings.HasPrefix(cfg.Peers[peerName].URL, "grpcs://") != strings.HasPrefix(cfg.Peers[org.Peers[0]].URL, "grpcs://") {
+				fail("organizations.%s mixes grpc:// and grpcs:// peers", name)
+			}
+		}
+		if ca := org.CA; ca != nil {
+			switch {
+			case strings.HasPrefix(ca.URL, "https://"):
+				checkFile(fail, "organizations."+name+".certificateAuthority.tlsCACerts.path", ca.TLSCACerts.Path)
+			case !strings.HasPrefix(ca.URL, "http://"):
+				fail("organizations.%s.certificateAuthority.url: %q must start with http:// or https://", name, ca.URL)
+			}
+			if ca.Registrar.EnrollID == "" || ca.Registrar.EnrollSecret == "" {
+				fail("organizations.%s.certificateAuthority.registrar needs enrollId and enrollSecret", name)
+			}
+		}
+	}
+
+	for name, peer := range cfg.Peers {
+		if _, _, err := parseEndpointURL(peer.URL); err != nil {
+			fail("peers.%s.url: %v", name, err)
+		}
+		if strings.HasPrefix(peer.URL, "grpcs://") {
+			checkFile(fail, "peers."+name+".tlsCACerts.path", peer.TLSCACerts.Path)
+		}
+	}
+
+	for name, channel := range cfg.Channels {
+		for peerName := range channel.Peers {
+			if _, ok := cfg.Peers[peerName]; !ok {
+				fail("channels.%s refers to peer %q, which is not defined under peers", name, peerName)
+			}
+		}
+	}
+
+	if _, ok := cfg.Organizations[cfg.Client.Organization]; cfg.Client.Organization != "" && !ok {
+		fail("client.organization %q is not defined under organizations", cfg.Client.Organization)
+	}
+
+	return errors.Join(errs...)
+}
+
+// withDefaults fills the unset timeouts from defaults
+func (t CallTimeouts) withDefaults(defaults CallTimeouts) CallTimeouts {
+	if t.Evaluate == 0 {
+		t.Evaluate = defaults.Evaluate
+	}
+	if t.Endorse == 0 {
+		t.Endorse = defaults.Endorse
+	}
+	if t.Submit == 0 {
+		t.Submit = defaults.Submit
+	}
+	if t.CommitStatus == 0 {
+		t.CommitStatus = defaults.CommitStatus
+	}
+	return t
+}
+
+// checkFile reports a missing or unreadable file or directory
+func checkFile(fail func(string, ...interface{}), setting string, path string) {
+	if path == "" {
+		fail("%s must be set", setting)
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		fail("%s: %v", setting, err)
+	}
+}
+
+// certPath returns the identity certificate file, defaulting to the first file in the MSP's signcerts
+func (user UserConfig) certPath() string {
+	if user.CertPath != "" {
+		return user.CertPath
+	}
+
+	signcerts := filepath.Join(user.CryptoPath, "signcerts")
+	entries, err := os.ReadDir(signcerts)
+	if err != nil || len(entries) == 0 {
+		return signcerts
+	}
+	return filepath.Join(signcerts, entries[0].Name())
+}
+
+// keyPath returns the directory holding the identity's private key, defaulting to the MSP's keystore
+func (user UserConfig) keyPath() string {
+	if user.KeyPath != "" {
+		return user.KeyPath
+	}
+	return filepath.Join(user.CryptoPath, "keystore")
+}
+
+// parseEndpointURL splits a grpc:// or grpcs:// URL into its host:port address and whether it uses TLS
+func parseEndpointURL(url string) (address string, tls bool, err error) {
+	switch {
+	case strings.HasPrefix(url, "grpcs://"):
+		address, tls = strings.TrimPrefix(url, "grpcs://"), true
+	case strings.HasPrefix(url, "grpc://"):
+		address = strings.TrimPrefix(url, "grpc://")
+	default:
+		return "", false, fmt.Errorf("%q must start with grpc:// or grpcs://", url)
+	}
+
+	if address == "" {
+		return "", false, fmt.Errorf("%q has no address", url)
+	}
+	return address, tls, nil
+}
+
+// OrgSetups builds the gateway connection settings of every configured organization identity
+func (cfg *Config) OrgSetups() ([]OrgSetup, error) {
+	var setups []OrgSetup
+	for orgName, org := range cfg.Organizations {
+		var peers []PeerEndpoint
+		for _, peerName := range org.Peers {
+			peer := cfg.Peers[peerName]
+
+			address, tls, err := parseEndpointURL(peer.URL)
+			if err != nil {
+				return nil, err
+			}
+
+			endpoint := PeerEndpoint{Name: peerName, Address: address, ServerName: peerName}
+			if override := peer.GRPCOptions["ssl-target-name-override"]; override != "" {
+				endpoint.ServerName = override
+			}
+			if tls {
+				endpoint.TLSCertPath = peer.TLSCACerts.Path
+			}
+			peers = append(peers, endpoint)
+		}
+
+		for userName, user := range org.identities() {
+			setups = append(setups, OrgSetup{
+				OrgName:       orgName,
+				UserName:      userName,
+				MSPID:         org.MSPID,
+				CertPath:      user.certPath(),
+				KeyPath:       user.keyPath(),
+				APIKey:        user.APIKey,
+				Peers:         peers,
+				ChannelName:   cfg.Client.Channel,
+				ChaincodeName: cfg.Client.Chaincode,
+			})
+		}
+	}
+
+	return setups, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestTracingSampleRatioDefault(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		expected float64
+	}{
+		{"unset", "tracing:\n  exporter: otlp\n", 1},
+		{"zero", "tracing:\n  sampleRatio: 0\n", 0},
+		{"fraction", "tracing:\n  sampleRatio: 0.25\n", 0.25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			if err := yaml.Unmarshal([]byte(tt.yaml), &cfg); err != nil {
+				t.Fatal(err)
+			}
+			cfg.applyDefaults()
+
+			if cfg.Tracing.SampleRatio == nil || *cfg.Tracing.SampleRatio != tt.expected {
+				t.Fatalf("expected a sample ratio of %v, got %v", tt.expected, cfg.Tracing.SampleRatio)
+			}
+		})
+	}
+}
+
+func TestRetryIsOffByDefault(t *testing.T) {
+	var cfg Config
+	cfg.applyDefaults()
+
+	if cfg.Retry.MaxAttempts != 1 {
+		t.Fatalf("expected a single attempt by default, got %d", cfg.Retry.MaxAttempts)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+// PeerEndpoint describes how to reach one gateway peer of an organization
+type PeerEndpoint struct {
+	Name        string
+	Address     string
+	TLSCertPath string
+	ServerName  string
+}
+
+// PeerHealth reports the connection state of a gateway peer
+type PeerHealth struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	State   string `json:"state"`
+	Healthy bool   `json:"healthy"`
+	Active  bool   `json:"active"`
+}
+
+// ConnectionManager maintains the gRPC connection of an organization to its gateway peers. The connection
+// lists every peer, healthy ones first, and gRPC uses the first peer it can reach, so requests fail over
+// to another peer when the gateway peer goes down. Each peer is also probed over a connection of its own.
+// All connections reconnect with exponential backoff.
+type ConnectionManager struct {
+	org      string
+	peers    []PeerEndpoint
+	resolver *manual.Resolver
+	conn     *grpc.ClientConn
+	probes   []*grpc.ClientConn
+	stop     chan struct{}
+	done     chan struct{}
+
+	mu      sync.Mutex
+	healthy []bool
+	active  int
+}
+
+// NewConnectionManager connects to the organization's peers and starts checking their health. The
+// peers are tried in the given order, so the first one is the preferred gateway peer.
+func NewConnectionManager(org string, peers []PeerEndpoint, cfg ConnectionConfig) (*ConnectionManager, error) {
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("organization %s has no peers", org)
+	}
+
+	m := &ConnectionManager{
+		org:      org,
+		peers:    peers,
+		resolver: manual.NewBuilderWithScheme("fabric"),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		healthy:  make([]bool, len(peers)),
+		active:   -1,
+	}
+
+	connectParams := grpc.WithConnectParams(grpc.ConnectParams{
+		Backoff: backoff.Config{
+			BaseDelay:  cfg.ReconnectBaseDelay,
+			Multiplier: backoff.DefaultConfig.Multiplier,
+			Jitter:     backoff.DefaultConfig.Jitter,
+			MaxDelay:   cfg.ReconnectMaxDelay,
+		},
+		MinConnectTimeout: cfg.ConnectTimeout,
+	})
+
+	// The shared connection trusts the TLS CA of every peer; each address names the server to verify
+	transportCredentials, err := peerCredentials(peers, "")
+	if err != nil {
+		return nil, err
+	}
+	m.resolver.InitialState(resolver.State{Addresses: m.addresses(m.healthy)})
+	m.conn, err = grpc.Dial(m.resolver.Scheme()+":///"+strings.ToLower(org),
+		grpc.WithResolvers(m.resolver), grpc.WithTransportCredentials(transportCredentials), connectParams)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection for %s: %w", org, err)
+	}
+
+	for _, peer := range peers {
+		probeCredentials, err := peerCredentials([]PeerEndpoint{peer}, peer.ServerName)
+		if err != nil {
+			m.closeConnections()
+			return nil, err
+		}
+		probe, err := grpc.Dial(peer.Address, grpc.WithTransportCredentials(probeCredentials), connectParams)
+		if err != nil {
+			m.closeConnections()
+			return nil, fmt.Errorf("failed to create gRPC connection to peer %s: %w", peer.Name, err)
+		}
+		m.probes = append(m.probes, probe)
+	}
+
+	go m.run(cfg.HealthCheckInterval)
+
+	return m, nil
+}
+
+// peerCredentials returns TLS credentials trusting the CA certificates of the peers, or insecure
+// credentials when the peers are configured with grpc:// URLs
+func peerCredentials(peers []PeerEndpoint, serverName string) (credentials.TransportCredentials, error) {
+	if peers[0].TLSCertPath == "" {
+		return insecure.NewCredentials(), nil
+	}
+
+	certPool := x509.NewCertPool()
+	for _, peer := range peers {
+		certificate, err := loadCertificate(peer.TLSCertPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate of peer %s: %w", peer.Name, err)
+		}
+		certPool.AddCert(certificate)
+	}
+	return credentials.NewClientTLSFromCert(certPool, serverName), nil
+}
+
+// ClientConn returns the connection the organization's gateways use
+func (m *ConnectionManager) ClientConn() *grpc.ClientConn {
+	return m.conn
+}
+
+// Peers returns the organization's peers in configured order
+func (m *ConnectionManager) Peers() []PeerEndpoint {
+	return m.peers
+}
+
+// WaitForPeer waits while the probe connection of the i-th peer is connecting and returns its state once
+// it is ready, has failed to connect or the context is done
+func (m *ConnectionManager) WaitForPeer(ctx context.Context, i int) connectivity.State {
+	probe := m.probes[i]
+	for {
+		state := probe.GetState()
+		switch state {
+		case connectivity.Ready, connectivity.TransientFailure, connectivity.Shutdown:
+			return state
+		case connectivity.Idle:
+			probe.Connect()
+		}
+		if !probe.WaitForStateChange(ctx, state) {
+			return probe.GetState()
+		}
+	}
+}
+
+// run checks the health of the peers at every interval until the manager is closed
+func (m *ConnectionManager) run(interval time.Duration) {
+	defer close(m.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.checkHealth()
+		select {
+		case <-ticker.C:
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// checkHealth probes every peer and moves unreachable peers behind the reachable ones
+func (m *ConnectionManager) checkHealth() {
+	healthy := make([]bool, len(m.probes))
+	for i, probe := range m.probes {
+		state := probe.GetState()
+		if state == connectivity.Idle {
+			probe.Connect()
+		}
+		healthy[i] = state == connectivity.Ready
+	}
+
+	active := -1
+	for i := range healthy {
+		if healthy[i] {
+			active = i
+			break
+		}
+	}
+
+	m.mu.Lock()
+	changed := false
+	for i := range healthy {
+		changed = changed || healthy[i] != m.healthy[i]
+	}
+	previous := m.active
+	m.healthy, m.active = healthy, active
+	m.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	m.resolver.UpdateState(resolver.State{Addresses: m.addresses(healthy)})
+
+	switch {
+	case active == previous:
+	case active < 0:
+		log.Printf("No gateway peer of %s is reachable", m.org)
+	case previous < 0:
+		log.Printf("Gateway peer of %s is %s", m.org, m.peers[active].Name)
+	default:
+		log.Printf("Gateway peer of %s failed over from %s to %s", m.org, m.peers[previous].Name, m.peers[active].Name)
+	}
+}
+
+// addresses lists the peer addresses for the shared connection, healthy peers first in configured order
+func (m *ConnectionManager) addresses(healthy []bool) []resolver.Address {
+	var first, last []resolver.Address
+	for i, peer := range m.peers {
+		address := resolver.Address{Addr: peer.Address, ServerName: peer.ServerName}
+		if healthy[i] {
+			first = append(first, address)
+		} else {
+			last = append(last, address)
+		}
+	}
+	return append(first, last...)
+}
+
+// Health reports the state of every peer as of the last health check
+func (m *ConnectionManager) Health() []PeerHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	health := make([]PeerHealth, len(m.peers))
+	for i, peer := range m.peers {
+		health[i] = PeerHealth{
+			Name:    peer.Name,
+			Address: peer.Address,
+			State:   m.probes[i].GetState().String(),
+			Healthy: m.healthy[i],
+			Active:  i == m.active,
+		}
+	}
+	return health
+}
+
+// Close stops the health checks and closes every connection
+func (m *ConnectionManager) Close() {
+	select {
+	case <-m.stop:
+		return
+	default:
+		close(m.stop)
+	}
+	<-m.done
+
+	m.closeConnections()
+}
+
+// closeConnections closes the shared connection and the probe connections
+func (m *ConnectionManager) closeConnections() {
+	for _, probe := range m.probes {
+		probe.Close()
+	}
+	m.conn.Close()
+}
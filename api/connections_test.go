@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	gatewaypb "github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/grpc"
+)
+
+// testConnectionConfig checks health and reconnects quickly, so failovers happen within a test
+var testConnectionConfig = ConnectionConfig{
+	HealthCheckInterval: 20 * time.Millisecond,
+	ConnectTimeout:      time.Second,
+	ReconnectBaseDelay:  10 * time.Millisecond,
+	ReconnectMaxDelay:   50 * time.Millisecond,
+}
+
+// startPeer serves gRPC on a free local port, with the gateway service unless it is nil, and returns
+// the server and its address
+func startPeer(t *testing.T, gateway gatewaypb.GatewayServer) (*grpc.Server, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	if gateway != nil {
+		gatewaypb.RegisterGatewayServer(server, gateway)
+	}
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return server, listener.Addr().String()
+}
+
+// unusedAddress returns a local address nothing listens on
+func unusedAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+// waitForActive waits until the health checks make the named peer the active one, or none when name is empty
+func waitForActive(t *testing.T, m *ConnectionManager, name string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		active := ""
+		for _, peer := range m.Health() {
+			if peer.Active {
+				active = peer.Name
+			}
+		}
+		if active == name {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %q to become the active peer, got %q: %+v", name, active, m.Health())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConnectionManagerAddressOrder(t *testing.T) {
+	m := &ConnectionManager{peers: []PeerEndpoint{
+		{Name: "peer0", Address: "peer0:7051"},
+		{Name: "peer1", Address: "peer1:7051"},
+		{Name: "peer2", Address: "peer2:7051"},
+	}}
+
+	tests := []struct {
+		healthy  []bool
+		expected []string
+	}{
+		{[]bool{true, true, true}, []string{"peer0:7051", "peer1:7051", "peer2:7051"}},
+		{[]bool{false, true, true}, []string{"peer1:7051", "peer2:7051", "peer0:7051"}},
+		{[]bool{false, false, true}, []string{"peer2:7051", "peer0:7051", "peer1:7051"}},
+		{[]bool{true, false, true}, []string{"peer0:7051", "peer2:7051", "peer1:7051"}},
+		{[]bool{false, false, false}, []string{"peer0:7051", "peer1:7051", "peer2:7051"}},
+	}
+
+	for _, tt := range tests {
+		var addresses []string
+		for _, address := range m.addresses(tt.healthy) {
+			addresses = append(addresses, address.Addr)
+		}
+		if !reflect.DeepEqual(addresses, tt.expected) {
+			t.Errorf("healthy %v: expected %v, got %v", tt.healthy, tt.expected, addresses)
+		}
+	}
+}
+
+func TestConnectionManagerFailsOver(t *testing.T) {
+	server1, address1 := startPeer(t, nil)
+	_, address2 := startPeer(t, nil)
+
+	m, err := NewConnectionManager("Org1", []PeerEndpoint{
+		{Name: "peer0", Address: unusedAddress(t)},
+		{Name: "peer1", Address: address1},
+		{Name: "peer2", Address: address2},
+	}, testConnectionConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// The preferred peer is down, so the next one in configured order is used
+	waitForActive(t, m, "peer1")
+
+	server1.Stop()
+	waitForActive(t, m, "peer2")
+
+	health := m.Health()
+	if health[0].Healthy || health[1].Healthy || !health[2].Healthy {
+		t.Fatalf("expected only peer2 to be healthy, got %+v", health)
+	}
+}
+
+func TestConnectionManagerCloseIsIdempotent(t *testing.T) {
+	_, address := startPeer(t, nil)
+
+	m, err := NewConnectionManager("Org1", []PeerEndpoint{{Name: "peer0", Address: address}}, testConnectionConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForActive(t, m, "peer0")
+
+	m.Close()
+	m.Close()
+}
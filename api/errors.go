@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// chaincodeErrorCode matches the "[CODE]" prefix of the typed errors returned by the chaincode
+var chaincodeErrorCode = regexp.MustCompile(`\[([A-Z_]+)\]`)
+
+// chaincodeErrorStatus maps the chaincode error codes to HTTP status codes
+var chaincodeErrorStatus = map[string]int{
+	"NOT_FOUND":        http.StatusNotFound,
+	"ALREADY_EXISTS":   http.StatusConflict,
+	"FORBIDDEN":        http.StatusForbidden,
+	"INVALID_ARGUMENT": http.StatusUnprocessableEntity,
+}
+
+// ErrorResponse is the JSON body of an error response
+type ErrorResponse struct {
+	Error         string             `json:"error"`
+	Code          string             `json:"code"`
+	TransactionID string             `json:"transactionId,omitempty"`
+	Details       []EndorsementError `json:"details,omitempty"`
+}
+
+// EndorsementError is the error reported by one peer or orderer the gateway contacted
+type EndorsementError struct {
+	Address string `json:"address"`
+	MSPID   string `json:"mspId"`
+	Message string `json:"message"`
+}
+
+// CommitFailedError is returned when a submitted transaction is committed as invalid. It plays the part
+// of the gateway's CommitError for transactions whose commit status the API waits for itself.
+type CommitFailedError struct {
+	TransactionID string
+	Code          peer.TxValidationCode
+}
+
+func (e *CommitFailedError) Error() string {
+	return fmt.Sprintf("transaction %s failed to commit with status code %s", e.TransactionID, e.Code)
+}
+
+// respondWithError writes the error as an ErrorResponse with the HTTP status that fits it best
+func respondWithError(c *gin.Context, err error) {
+	httpStatus, response := classifyError(err)
+	c.JSON(httpStatus, response)
+}
+
+// classifyError derives the HTTP status and error response from a gateway error. Typed chaincode errors
+// take precedence, followed by the validation code of a failed commit and the gRPC status of the call.
+func classifyError(err error) (int, ErrorResponse) {
+	response := ErrorResponse{Error: err.Error(), Code: "INTERNAL", TransactionID: transactionID(err)}
+
+	var grpcStatus *status.Status
+	var statusErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &statusErr) {
+		grpcStatus = statusErr.GRPCStatus()
+		for _, detail := range grpcStatus.Details() {
+			if d, ok := detail.(*gateway.ErrorDetail); ok {
+				response.Details = append(response.Details, EndorsementError{Address: d.GetAddress(), MSPID: d.GetMspId(), Message: d.GetMessage()})
+			}
+		}
+	}
+
+	// Each endorsing peer runs the chaincode, so a typed error is usually found in every detail
+	messages := []string{err.Error()}
+	for _, detail := range response.Details {
+		messages = append(messages, detail.Message)
+	}
+	for _, message := range messages {
+		if match := chaincodeErrorCode.FindStringSubmatch(message); match != nil {
+			if httpStatus, ok := chaincodeErrorStatus[match[1]]; ok {
+				response.Code = match[1]
+				return httpStatus, response
+			}
+		}
+	}
+
+	var commitErr *CommitFailedError
+	if errors.As(err, &commitErr) {
+		switch commitErr.Code {
+		case peer.TxValidationCode_MVCC_READ_CONFLICT, peer.TxValidationCode_PHANTOM_READ_CONFLICT:
+			response.Code = "READ_CONFLICT"
+			return http.StatusConflict, response
+		case peer.TxValidationCode_ENDORSEMENT_POLICY_FAILURE:
+			response.Code = "ENDORSEMENT_POLICY_FAILURE"
+			return http.StatusForbidden, response
+		}
+		response.Code = commitErr.Code.String()
+		return http.StatusUnprocessableEntity, response
+	}
+
+	if grpcStatus != nil {
+		switch grpcStatus.Code() {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+			response.Code = "UNAVAILABLE"
+			return http.StatusServiceUnavailable, response
+		case codes.PermissionDenied, codes.Unauthenticated:
+			response.Code = "FORBIDDEN"
+			return http.StatusForbidden, response
+		case codes.InvalidArgument, codes.FailedPrecondition:
+			response.Code = "INVALID_ARGUMENT"
+			return http.StatusUnprocessableEntity, response
+		case codes.NotFound:
+			response.Code = "NOT_FOUND"
+			return http.StatusNotFound, response
+		}
+	}
+
+	return http.StatusInternalServerError, response
+}
+
+// transactionID returns the ID of the transaction a gateway error belongs to, if any
+func transactionID(err error) string {
+	var endorseErr *client.EndorseError
+	var submitErr *client.SubmitError
+	var commitStatusErr *client.CommitStatusError
+	var commitErr *client.CommitError
+	var commitFailedErr *CommitFailedError
+
+	switch {
+	case errors.As(err, &endorseErr):
+		return endorseErr.TransactionID
+	case errors.As(err, &submitErr):
+		return submitErr.TransactionID
+	case errors.As(err, &commitStatusErr):
+		return commitStatusErr.TransactionID
+	case errors.As(err, &commitErr):
+		return commitErr.TransactionID
+	case errors.As(err, &commitFailedErr):
+		return commitFailedErr.TransactionID
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// endorseError returns a gateway error whose details carry the message of one endorsing peer
+func endorseError(t *testing.T, code codes.Code, message string) error {
+	t.Helper()
+	st, err := status.New(code, "failed to endorse transaction, see attached details for more info").WithDetails(
+		&gateway.ErrorDetail{Address: "peer0.bank.myindo.com:7051", MspId: "BankMSP", Message: message},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st.Err()
+}
+
+func TestClassifyChaincodeErrors(t *testing.T) {
+	tests := []struct {
+		code       string
+		httpStatus int
+	}{
+		{"NOT_FOUND", http.StatusNotFound},
+		{"ALREADY_EXISTS", http.StatusConflict},
+		{"FORBIDDEN", http.StatusForbidden},
+		{"INVALID_ARGUMENT", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			message := fmt.Sprintf("chaincode response 500, [%s] the asset asset1 failed", tt.code)
+
+			// The code is found in the peer's error detail as well as in a plain error message
+			for _, err := range []error{endorseError(t, codes.Aborted, message), errors.New(message)} {
+				httpStatus, response := classifyError(err)
+				if httpStatus != tt.httpStatus || response.Code != tt.code {
+					t.Errorf("%v: expected %d %s, got %d %s", err, tt.httpStatus, tt.code, httpStatus, response.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestClassifyErrorDetails(t *testing.T) {
+	_, response := classifyError(endorseError(t, codes.Aborted, "chaincode response 500, [NOT_FOUND] the asset asset1 does not exist"))
+	if len(response.Details) != 1 || response.Details[0].MSPID != "BankMSP" {
+		t.Fatalf("expected the endorsing peer's detail, got %+v", response.Details)
+	}
+}
+
+func TestClassifyOtherErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		httpStatus int
+		code       string
+	}{
+		{"unknown chaincode code", errors.New("[SOMETHING_ELSE] failed"), http.StatusInternalServerError, "INTERNAL"},
+		{"read conflict", &CommitFailedError{TransactionID: "tx1", Code: peer.TxValidationCode_MVCC_READ_CONFLICT}, http.StatusConflict, "READ_CONFLICT"},
+		{"endorsement policy", &CommitFailedError{TransactionID: "tx1", Code: peer.TxValidationCode_ENDORSEMENT_POLICY_FAILURE}, http.StatusForbidden, "ENDORSEMENT_POLICY_FAILURE"},
+		{"unavailable", status.Error(codes.Unavailable, "connection refused"), http.StatusServiceUnavailable, "UNAVAILABLE"},
+		{"deadline", status.Error(codes.DeadlineExceeded, "context deadline exceeded"), http.StatusServiceUnavailable, "UNAVAILABLE"},
+		{"permission denied", status.Error(codes.PermissionDenied, "access denied"), http.StatusForbidden, "FORBIDDEN"},
+		{"not found", status.Error(codes.NotFound, "chaincode not found"), http.StatusNotFound, "NOT_FOUND"},
+		{"other", errors.New("boom"), http.StatusInternalServerError, "INTERNAL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpStatus, response := classifyError(tt.err)
+			if httpStatus != tt.httpStatus || response.Code != tt.code {
+				t.Errorf("expected %d %s, got %d %s", tt.httpStatus, tt.code, httpStatus, response.Code)
+			}
+		})
+	}
+
+	// A typed chaincode error wins over the status of the call
+	httpStatus, _ := classifyError(endorseError(t, codes.Unavailable, "[FORBIDDEN] caller is not the owner"))
+	if httpStatus != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, httpStatus)
+	}
+}
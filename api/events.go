@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"golang.org/x/net/websocket"
+)
+
+// ChaincodeEvent represents a chaincode event delivered to streaming clients
+type ChaincodeEvent struct {
+	BlockNumber   uint64          `json:"blockNumber"`
+	TransactionID string          `json:"txId"`
+	EventName     string          `json:"eventName"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// eventFilter selects the chaincode events a streaming client receives and where the stream starts
+type eventFilter struct {
+	EventNames map[string]bool
+	AssetID    string
+	StartBlock *uint64
+	// AfterTxID skips events of StartBlock up to and including this transaction, so that a
+	// client resuming from its last event ID does not receive that event again
+	AfterTxID string
+}
+
+// parseEventFilter reads the event, assetId and startBlock query parameters. A Last-Event-ID header,
+// as sent by reconnecting SSE clients, takes precedence over startBlock.
+func parseEventFilter(c *gin.Context) (*eventFilter, error) {
+	filter := &eventFilter{
+		EventNames: make(map[string]bool),
+		AssetID:    c.Query("assetId"),
+	}
+
+	for _, names := range c.QueryArray("event") {
+		for _, name := range strings.Split(names, ",") {
+			if name != "" {
+				filter.EventNames[name] = true
+			}
+		}
+	}
+
+	if lastEventID := c.GetHeader("Last-Event-ID"); lastEventID != "" {
+		block, txID, err := parseEventID(lastEventID)
+		if err != nil {
+			return nil, err
+		}
+		filter.StartBlock = &block
+		filter.AfterTxID = txID
+		return filter, nil
+	}
+
+	if startBlock := c.Query("startBlock"); startBlock != "" {
+		block, err := strconv.ParseUint(startBlock, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("startBlock must be a block number")
+		}
+		filter.StartBlock = &block
+	}
+
+	return filter, nil
+}
+
+// eventID identifies an event by block number and transaction ID, in the form <block>:<txId>
+func eventID(blockNumber uint64, txID string) string {
+	return fmt.Sprintf("%d:%s", blockNumber, txID)
+}
+
+// parseEventID splits an ID produced by eventID
+func parseEventID(id string) (uint64, string, error) {
+	parts := strings.SplitN(id, ":", 2)
+	block, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil || len(parts) != 2 {
+		return 0, "", fmt.Errorf("invalid event ID %q", id)
+	}
+
+	return block, parts[1], nil
+}
+
+// streamChaincodeEvents returns the chaincode events matching the filter, received through the
+// given gateway, until ctx is done
+func streamChaincodeEvents(ctx context.Context, setup *OrgSetup, filter *eventFilter) (<-chan *ChaincodeEvent, error) {
+	network := setup.Gateway.GetNetwork(setup.ChannelName)
+
+	var options []client.ChaincodeEventsOption
+	if filter.StartBlock != nil {
+		options = append(options, client.WithStartBlock(*filter.StartBlock))
+	}
+
+	events, err := network.ChaincodeEvents(ctx, setup.ChaincodeName, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start chaincode event listening: %v", err)
+	}
+
+	return filterEvents(ctx, events, filter), nil
+}
+
+// filterEvents passes on the events matching the filter until events closes or ctx is done,
+// skipping those a resuming client has already received
+func filterEvents(ctx context.Context, events <-chan *client.ChaincodeEvent, filter *eventFilter) <-chan *ChaincodeEvent {
+	filtered := make(chan *ChaincodeEvent)
+	go func() {
+		defer close(filtered)
+
+		skipping := filter.AfterTxID != ""
+		for event := range events {
+			if skipping {
+				if event.BlockNumber == *filter.StartBlock {
+					if event.TransactionID == filter.AfterTxID {
+						skipping = false
+					}
+					continue
+				}
+				skipping = false
+			}
+
+			if !filter.matches(event) {
+				continue
+			}
+
+			select {
+			case filtered <- &ChaincodeEvent{
+				BlockNumber:   event.BlockNumber,
+				TransactionID: event.TransactionID,
+				EventName:     event.EventName,
+				Payload:       event.Payload,
+			}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return filtered
+}
+
+// matches reports whether the event passes the name and asset filters
+func (filter *eventFilter) matches(event *client.ChaincodeEvent) bool {
+	if len(filter.EventNames) > 0 && !filter.EventNames[event.EventName] {
+		return false
+	}
+
+	if filter.AssetID != "" {
+		var payload struct {
+			AssetID  string   `json:"assetId"`
+			AssetIDs []string `json:"assetIds"`
+		}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return false
+		}
+		if payload.AssetID == filter.AssetID {
+			return true
+		}
+		for _, id := range payload.AssetIDs {
+			if id == filter.AssetID {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// streamsCtx ends the open event streams when the server shuts down, since they never finish on their own
+var streamsCtx, stopStreams = context.WithCancel(context.Background())
+
+// streamContext returns a context for an event stream that is done when the request is or at shutdown
+func streamContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	stop := context.AfterFunc(streamsCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// streamEventsSSE streams chaincode events to the client as Server-Sent Events.
+// Each event carries an ID that the client sends back in Last-Event-ID to resume after a reconnect.
+func streamEventsSSE(c *gin.Context) {
+	filter, err := parseEventFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := streamContext(c)
+	defer cancel()
+
+	events, err := streamChaincodeEvents(ctx, requestGateway(c), filter)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Stream(func(w io.Writer) bool {
+		event, ok := <-events
+		if !ok {
+			return false
+		}
+
+		c.Render(-1, sse.Event{
+			Id:    eventID(event.BlockNumber, event.TransactionID),
+			Event: event.EventName,
+			Data:  event,
+		})
+		return true
+	})
+}
+
+// streamEventsWebSocket streams chaincode events to the client as JSON WebSocket messages
+func streamEventsWebSocket(c *gin.Context) {
+	filter, err := parseEventFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	setup := requestGateway(c)
+	server := websocket.Server{
+		// Apply the CORS policy of the REST routes to the handshake
+		Handshake: func(config *websocket.Config, req *http.Request) error {
+			if !originAllowed(req.Header.Get("Origin")) {
+				return fmt.Errorf("origin %s is not allowed", req.Header.Get("Origin"))
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			ctx, cancel := streamContext(c)
+			defer cancel()
+
+			// The client sends nothing, so a failed read means it has gone away
+			go func() {
+				var discard []byte
+				for websocket.Message.Receive(ws, &discard) == nil {
+				}
+				cancel()
+			}()
+
+			events, err := streamChaincodeEvents(ctx, setup, filter)
+			if err != nil {
+				websocket.JSON.Send(ws, gin.H{"error": err.Error()})
+				return
+			}
+
+			for event := range events {
+				if err := websocket.JSON.Send(ws, event); err != nil {
+					log.Printf("Failed to send event to WebSocket client: %v", err)
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// eventFilterFor parses the event filter of a stream request with the query and Last-Event-ID header
+func eventFilterFor(t *testing.T, query, lastEventID string) (*eventFilter, error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/events/stream?"+query, nil)
+	if lastEventID != "" {
+		c.Request.Header.Set("Last-Event-ID", lastEventID)
+	}
+	return parseEventFilter(c)
+}
+
+// collectEvents runs the events through the filter and returns the IDs of those passed on
+func collectEvents(filter *eventFilter, events ...*client.ChaincodeEvent) []string {
+	source := make(chan *client.ChaincodeEvent, len(events))
+	for _, event := range events {
+		source <- event
+	}
+	close(source)
+
+	var ids []string
+	for event := range filterEvents(context.Background(), source, filter) {
+		ids = append(ids, eventID(event.BlockNumber, event.TransactionID))
+	}
+	return ids
+}
+
+func TestParseEventFilter(t *testing.T) {
+	filter, err := eventFilterFor(t, "event=AssetCreated,AssetDeleted&event=AssetUpdated&assetId=asset1&startBlock=3", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedNames := map[string]bool{"AssetCreated": true, "AssetDeleted": true, "AssetUpdated": true}
+	if !reflect.DeepEqual(filter.EventNames, expectedNames) || filter.AssetID != "asset1" {
+		t.Fatalf("unexpected filter: %+v", filter)
+	}
+	if filter.StartBlock == nil || *filter.StartBlock != 3 || filter.AfterTxID != "" {
+		t.Fatalf("expected to start at block 3, got %+v", filter)
+	}
+
+	// Last-Event-ID takes precedence over startBlock
+	filter, err = eventFilterFor(t, "startBlock=3", "7:tx2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.StartBlock == nil || *filter.StartBlock != 7 || filter.AfterTxID != "tx2" {
+		t.Fatalf("expected to resume after tx2 of block 7, got %+v", filter)
+	}
+
+	for _, tt := range []struct{ query, lastEventID string }{
+		{"startBlock=latest", ""},
+		{"", "tx2"},
+		{"", "seven:tx2"},
+	} {
+		if _, err := eventFilterFor(t, tt.query, tt.lastEventID); err == nil {
+			t.Errorf("query %q with Last-Event-ID %q: expected an error", tt.query, tt.lastEventID)
+		}
+	}
+}
+
+func TestFilterEventsResumesAfterLastEventID(t *testing.T) {
+	events := []*client.ChaincodeEvent{
+		{BlockNumber: 7, TransactionID: "tx1", EventName: "AssetCreated", Payload: []byte(`{"assetId":"asset1"}`)},
+		{BlockNumber: 7, TransactionID: "tx2", EventName: "AssetCreated", Payload: []byte(`{"assetId":"asset2"}`)},
+		{BlockNumber: 7, TransactionID: "tx3", EventName: "AssetUpdated", Payload: []byte(`{"assetId":"asset1"}`)},
+		{BlockNumber: 8, TransactionID: "tx4", EventName: "AssetDeleted", Payload: []byte(`{"assetId":"asset2"}`)},
+		{BlockNumber: 9, TransactionID: "tx5", EventName: "LedgerInitialized", Payload: []byte(`{"assetIds":["asset1","asset3"]}`)},
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		lastEventID string
+		expected    []string
+	}{
+		{"from the start block", "startBlock=7", "", []string{"7:tx1", "7:tx2", "7:tx3", "8:tx4", "9:tx5"}},
+		{"resuming within a block", "", "7:tx2", []string{"7:tx3", "8:tx4", "9:tx5"}},
+		{"resuming after the last event of a block", "", "7:tx3", []string{"8:tx4", "9:tx5"}},
+		{"resuming with a filter", "assetId=asset1", "7:tx1", []string{"7:tx3", "9:tx5"}},
+		{"event names", "event=AssetCreated,AssetDeleted", "", []string{"7:tx1", "7:tx2", "8:tx4"}},
+	}
+
+	for _, tt := range tests {
+		filter, err := eventFilterFor(t, tt.query, tt.lastEventID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := collectEvents(filter, events...); !reflect.DeepEqual(ids, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, ids)
+		}
+	}
+}
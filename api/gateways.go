@@ -0,0 +1,302 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"google.golang.org/grpc"
+)
+
+// Request headers that select the organization and identity a request transacts as
+const (
+	orgHeader    = "X-Fabric-Org"
+	userHeader   = "X-Fabric-User"
+	apiKeyHeader = "X-API-Key"
+)
+
+// gatewayContextKey stores the selected OrgSetup in the gin context
+const gatewayContextKey = "orgSetup"
+
+// organizationContextKey stores the OrgSetup selected by selectOrganization, which has no connected gateway
+const organizationContextKey = "organization"
+
+// GatewayRegistry holds a gateway connection for every organization identity. Identities configured
+// in config.yaml are connected at startup; identities enrolled into the wallet are connected on first use.
+type GatewayRegistry struct {
+	mu               sync.Mutex
+	orgs             map[string]OrgSetup
+	connections      map[string]*ConnectionManager
+	setups           map[string]map[string]*OrgSetup
+	apiKeys          map[string]string
+	wallet           Wallet
+	defaultOrg       string
+	connectionConfig ConnectionConfig
+}
+
+// NewGatewayRegistry creates an empty registry whose default organization is defaultOrg and whose
+// identities are held in the wallet
+func NewGatewayRegistry(defaultOrg string, wallet Wallet, connectionConfig ConnectionConfig) *GatewayRegistry {
+	return &GatewayRegistry{
+		orgs:             make(map[string]OrgSetup),
+		connections:      make(map[string]*ConnectionManager),
+		setups:           make(map[string]map[string]*OrgSetup),
+		apiKeys:          make(map[string]string),
+		wallet:           wallet,
+		defaultOrg:       defaultOrg,
+		connectionConfig: connectionConfig,
+	}
+}
+
+// AddOrg opens the gRPC connection to the organization's gateway peers, shared by all its identities
+func (r *GatewayRegistry) AddOrg(setup OrgSetup) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.orgs[setup.OrgName]; ok {
+		return nil
+	}
+
+	connection, err := NewConnectionManager(setup.OrgName, setup.Peers, r.connectionConfig)
+	if err != nil {
+		return err
+	}
+	setup.UserName, setup.CertPath, setup.KeyPath, setup.APIKey = "", "", "", ""
+	r.orgs[setup.OrgName] = setup
+	r.connections[setup.OrgName] = connection
+	return nil
+}
+
+// Connection returns the gRPC connection to the organization's gateway peers
+func (r *GatewayRegistry) Connection(org string) *grpc.ClientConn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.connections[org].ClientConn()
+}
+
+// Connections returns the connection manager of every organization
+func (r *GatewayRegistry) Connections() map[string]*ConnectionManager {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	connections := make(map[string]*ConnectionManager, len(r.connections))
+	for org, connection := range r.connections {
+		connections[org] = connection
+	}
+	return connections
+}
+
+// SetAPIKey requires requests that select the identity to present the key
+func (r *GatewayRegistry) SetAPIKey(org, user, apiKey string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.apiKeys[walletLabel(org, user)] = apiKey
+}
+
+// Lookup returns the gateway of the named organization identity, connecting it from the wallet if it
+// is not connected yet. An empty org selects the default organization and an empty user selects the
+// organization's default identity.
+func (r *GatewayRegistry) Lookup(org, user string) (*OrgSetup, error) {
+	if org == "" {
+		org = r.defaultOrg
+	}
+	if user == "" {
+		user = defaultUserName
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if setup, ok := r.setups[org][user]; ok {
+		return setup, nil
+	}
+
+	template, ok := r.orgs[org]
+	if !ok {
+		return nil, fmt.Errorf("unknown organization %s", org)
+	}
+
+	id, err := r.wallet.Get(walletLabel(org, user))
+	if errors.Is(err, errIdentityNotFound) {
+		return nil, fmt.Errorf("unknown identity %s of organization %s", user, org)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if id.MSPID != template.MSPID {
+		return nil, fmt.Errorf("identity %s belongs to %s, not to organization %s", user, id.MSPID, org)
+	}
+
+	clientIdentity, err := id.newIdentity()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create identity %s of %s: %v", user, org, err)
+	}
+	sign, err := id.newSign()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sign function for %s of %s: %v", user, org, err)
+	}
+
+	gateway, err := client.Connect(
+		clientIdentity,
+		client.WithSign(sign),
+		client.WithClientConnection(r.connections[org].ClientConn()),
+		// Call timeouts come from the request context; see applyCallTimeouts
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to gateway for %s as %s: %v", org, user, err)
+	}
+
+	setup := template
+	setup.UserName = user
+	setup.APIKey = r.apiKeys[walletLabel(org, user)]
+	setup.Gateway = *gateway
+
+	if r.setups[org] == nil {
+		r.setups[org] = make(map[string]*OrgSetup)
+	}
+	r.setups[org][user] = &setup
+	log.Printf("Connected gateway for %s as %s", org, user)
+
+	return &setup, nil
+}
+
+// Org returns the organization's configuration without a connected identity. An empty org selects the
+// default organization.
+func (r *GatewayRegistry) Org(org string) (*OrgSetup, error) {
+	if org == "" {
+		org = r.defaultOrg
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	setup, ok := r.orgs[org]
+	if !ok {
+		return nil, fmt.Errorf("unknown organization %s", org)
+	}
+	return &setup, nil
+}
+
+// Default returns the default identity of the default organization
+func (r *GatewayRegistry) Default() *OrgSetup {
+	setup, err := r.Lookup("", "")
+	if err != nil {
+		log.Panicf("default gateway is not available: %v", err)
+	}
+	return setup
+}
+
+// Disconnect closes the gateway of an organization identity, for example after its identity
+// has been removed from the wallet
+func (r *GatewayRegistry) Disconnect(org, user string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if setup, ok := r.setups[org][user]; ok {
+		setup.Gateway.Close()
+		delete(r.setups[org], user)
+	}
+}
+
+// Close closes every gateway and the gRPC connections they share. Requests still using a gateway fail.
+func (r *GatewayRegistry) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, users := range r.setups {
+		for _, setup := range users {
+			setup.Gateway.Close()
+		}
+	}
+	for _, connection := range r.connections {
+		connection.Close()
+	}
+}
+
+// selectGateway picks the identity a request transacts as. With authentication enabled it is the
+// identity of the request's bearer token. Otherwise the organization comes from the :org route
+// parameter or the X-Fabric-Org header, the identity from the X-Fabric-User header, and the
+// identity's API key is checked if it has one.
+func selectGateway(c *gin.Context) {
+	org := c.Param("org")
+	if org == "" {
+		org = c.GetHeader(orgHeader)
+	}
+	user := c.GetHeader(userHeader)
+
+	if authenticator != nil {
+		var ok bool
+		if org, user, ok = authenticateRequest(c, org, user); !ok {
+			return
+		}
+
+		setup, err := gateways.Lookup(org, user)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(gatewayContextKey, setup)
+		c.Next()
+		return
+	}
+
+	setup, err := gateways.Lookup(org, user)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if setup.APIKey != "" && subtle.ConstantTimeCompare([]byte(c.GetHeader(apiKeyHeader)), []byte(setup.APIKey)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("a valid %s is required to act as %s of %s", apiKeyHeader, setup.UserName, setup.OrgName)})
+		return
+	}
+
+	c.Set(gatewayContextKey, setup)
+	c.Next()
+}
+
+// selectOrganization picks the organization an offline-signing request transacts with. Its client signs
+// with its own key, so no wallet identity is needed: with authentication enabled the organization and
+// user come from the bearer token alone, otherwise from the :org route parameter or the X-Fabric-Org
+// header and the X-Fabric-User header. The user, if any, is stored as the UserName of the OrgSetup.
+func selectOrganization(c *gin.Context) {
+	org := c.Param("org")
+	if org == "" {
+		org = c.GetHeader(orgHeader)
+	}
+	user := c.GetHeader(userHeader)
+
+	if authenticator != nil {
+		var ok bool
+		if org, user, ok = authenticateRequest(c, org, user); !ok {
+			return
+		}
+	}
+
+	setup, err := gateways.Org(org)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	setup.UserName = user
+
+	c.Set(organizationContextKey, setup)
+	c.Next()
+}
+
+// requestOrganization returns the organization selected for the request by selectOrganization
+func requestOrganization(c *gin.Context) *OrgSetup {
+	return c.MustGet(organizationContextKey).(*OrgSetup)
+}
+
+// requestGateway returns the gateway selected for the request by selectGateway
+func requestGateway(c *gin.Context) *OrgSetup {
+	return c.MustGet(gatewayContextKey).(*OrgSetup)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// newTestRegistry creates a registry for Org1, the default organization, and Org2 with identities from
+// the wallet. Their connection is never dialled, since connecting a gateway and creating messages happen locally.
+func newTestRegistry(t *testing.T, wallet Wallet) *GatewayRegistry {
+	t.Helper()
+	conn, err := grpc.Dial("passthrough:///localhost:7051", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	registry := NewGatewayRegistry("Org1", wallet, ConnectionConfig{})
+	for _, org := range []string{"Org1", "Org2"} {
+		registry.orgs[org] = OrgSetup{OrgName: org, MSPID: org + "MSP", ChannelName: "mychannel", ChaincodeName: "basic"}
+		registry.connections[org] = &ConnectionManager{conn: conn}
+	}
+	return registry
+}
+
+// putTestIdentity adds a generated identity of the MSP to the wallet under the user and org
+func putTestIdentity(t *testing.T, wallet Wallet, org, user, mspID string) {
+	t.Helper()
+	certificate, key := testCredentials(t, user)
+	if err := wallet.Put(walletLabel(org, user), NewWalletIdentity(mspID, []byte(certificate), []byte(key))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newGatewayRouter serves a route that reports the identity selectGateway picks
+func newGatewayRouter(t *testing.T) (*gin.Engine, Wallet) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	wallet := NewInMemoryWallet()
+	putTestIdentity(t, wallet, "Org1", defaultUserName, "Org1MSP")
+	putTestIdentity(t, wallet, "Org1", "alice", "Org1MSP")
+	putTestIdentity(t, wallet, "Org2", defaultUserName, "Org2MSP")
+	putTestIdentity(t, wallet, "Org2", "mallory", "Org1MSP")
+
+	previous := gateways
+	gateways = newTestRegistry(t, wallet)
+	t.Cleanup(func() { gateways = previous })
+
+	report := func(c *gin.Context) {
+		setup := requestGateway(c)
+		c.String(http.StatusOK, setup.UserName+"@"+setup.OrgName)
+	}
+	router := gin.New()
+	router.GET("/api/v1/assets", selectGateway, report)
+	router.GET("/api/v1/orgs/:org/assets", selectGateway, report)
+	return router, wallet
+}
+
+func TestSelectGateway(t *testing.T) {
+	router, _ := newGatewayRouter(t)
+	gateways.SetAPIKey("Org1", "alice", "alice-key")
+
+	tests := []struct {
+		name     string
+		path     string
+		headers  map[string]string
+		expected int
+		identity string
+	}{
+		{name: "default identity", path: "/api/v1/assets", expected: http.StatusOK, identity: "Admin@Org1"},
+		{name: "org header", path: "/api/v1/assets", headers: map[string]string{orgHeader: "Org2"}, expected: http.StatusOK, identity: "Admin@Org2"},
+		{name: "org route", path: "/api/v1/orgs/Org2/assets", expected: http.StatusOK, identity: "Admin@Org2"},
+		{name: "org route before header", path: "/api/v1/orgs/Org2/assets", headers: map[string]string{orgHeader: "Org1"}, expected: http.StatusOK, identity: "Admin@Org2"},
+		{name: "user with API key", path: "/api/v1/assets", headers: map[string]string{userHeader: "alice", apiKeyHeader: "alice-key"}, expected: http.StatusOK, identity: "alice@Org1"},
+		{name: "user without API key", path: "/api/v1/assets", headers: map[string]string{userHeader: "alice"}, expected: http.StatusUnauthorized},
+		{name: "user with a wrong API key", path: "/api/v1/assets", headers: map[string]string{userHeader: "alice", apiKeyHeader: "guess"}, expected: http.StatusUnauthorized},
+		{name: "unknown organization", path: "/api/v1/orgs/Org3/assets", expected: http.StatusNotFound},
+		{name: "unknown user", path: "/api/v1/assets", headers: map[string]string{userHeader: "bob"}, expected: http.StatusNotFound},
+		{name: "identity of another MSP", path: "/api/v1/orgs/Org2/assets", headers: map[string]string{userHeader: "mallory"}, expected: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		for header, value := range tt.headers {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.expected, w.Code, w.Body)
+			continue
+		}
+		if tt.identity != "" && w.Body.String() != tt.identity {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.identity, w.Body)
+		}
+	}
+}
+
+func TestSelectGatewayWithAuthentication(t *testing.T) {
+	router, _ := newGatewayRouter(t)
+	auth, err := NewAuthenticator(AuthConfig{HS256Secret: testHS256Secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := authenticator
+	authenticator = auth
+	t.Cleanup(func() { authenticator = previous })
+
+	// The token selects the identity; API keys are not needed
+	gateways.SetAPIKey("Org1", "alice", "alice-key")
+	tests := []struct {
+		subject  string
+		expected int
+	}{
+		{"alice@Org1", http.StatusOK},
+		{"Admin@Org2", http.StatusOK},
+		{"bob@Org1", http.StatusForbidden},
+		{"alice@Org3", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/assets", nil)
+		r.Header.Set("Authorization", "Bearer "+hs256Token(t, tt.subject))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected %d, got %d: %s", tt.subject, tt.expected, w.Code, w.Body)
+			continue
+		}
+		if tt.expected == http.StatusOK && w.Body.String() != tt.subject {
+			t.Errorf("%s: selected %s", tt.subject, w.Body)
+		}
+	}
+}
+
+func TestGatewayRegistryReusesAndDisconnectsGateways(t *testing.T) {
+	newGatewayRouter(t)
+
+	first, err := gateways.Lookup("Org1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := gateways.Lookup("Org1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatal("expected the connected gateway to be reused")
+	}
+
+	gateways.Disconnect("Org1", "alice")
+	third, err := gateways.Lookup("Org1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third == first {
+		t.Fatal("expected a new gateway after disconnecting")
+	}
+}
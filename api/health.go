@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/connectivity"
+)
+
+// readinessTimeout bounds all checks of a readiness probe together
+const readinessTimeout = 3 * time.Second
+
+// pingFunction is the chaincode function evaluated to check that the chaincode is reachable
+const pingFunction = "Ping"
+
+// ReadinessCheck is the result of one check of a readiness probe
+type ReadinessCheck struct {
+	Name         string  `json:"name"`
+	Organization string  `json:"organization"`
+	Peer         string  `json:"peer,omitempty"`
+	Address      string  `json:"address,omitempty"`
+	State        string  `json:"state,omitempty"`
+	Channel      string  `json:"channel,omitempty"`
+	Chaincode    string  `json:"chaincode,omitempty"`
+	Reachable    bool    `json:"reachable"`
+	DurationMs   float64 `json:"durationMs"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// ReadinessReport is the response of the readiness probe
+type ReadinessReport struct {
+	Status     string           `json:"status"`
+	DurationMs float64          `json:"durationMs"`
+	Checks     []ReadinessCheck `json:"checks"`
+}
+
+// livez reports that the process is up and serving requests. It checks no dependency, so an
+// unreachable peer does not get the API restarted.
+func livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
+
+// readyz reports whether the API can serve transactions: every organization must reach at least one of
+// its peers and evaluate the chaincode's Ping function. It responds 503 when a check fails.
+func readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	start := time.Now()
+	connections := gateways.Connections()
+
+	orgs := make([]string, 0, len(connections))
+	for org := range connections {
+		orgs = append(orgs, org)
+	}
+	sort.Strings(orgs)
+
+	results := make([][]ReadinessCheck, len(orgs))
+	var wg sync.WaitGroup
+	for i, org := range orgs {
+		wg.Add(1)
+		go func(i int, org string) {
+			defer wg.Done()
+			results[i] = checkOrganization(ctx, org, connections[org])
+		}(i, org)
+	}
+	wg.Wait()
+
+	report := ReadinessReport{Status: "ready", Checks: []ReadinessCheck{}}
+	for _, checks := range results {
+		peerReachable, chaincodeReachable := false, false
+		for _, check := range checks {
+			switch check.Name {
+			case "peer":
+				peerReachable = peerReachable || check.Reachable
+			case "chaincode":
+				chaincodeReachable = check.Reachable
+			}
+		}
+		if !peerReachable || !chaincodeReachable {
+			report.Status = "not ready"
+		}
+		report.Checks = append(report.Checks, checks...)
+	}
+	report.DurationMs = milliseconds(time.Since(start))
+
+	httpStatus := http.StatusOK
+	if report.Status != "ready" {
+		httpStatus = http.StatusServiceUnavailable
+	}
+	c.JSON(httpStatus, report)
+}
+
+// checkOrganization checks the gRPC connection to each of the organization's peers, then evaluates the
+// chaincode's Ping function as the organization's default identity
+func checkOrganization(ctx context.Context, org string, connection *ConnectionManager) []ReadinessCheck {
+	peers := connection.Peers()
+	checks := make([]ReadinessCheck, len(peers), len(peers)+1)
+
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer PeerEndpoint) {
+			defer wg.Done()
+			start := time.Now()
+			state := connection.WaitForPeer(ctx, i)
+			checks[i] = ReadinessCheck{
+				Name:         "peer",
+				Organization: org,
+				Peer:         peer.Name,
+				Address:      peer.Address,
+				State:        state.String(),
+				Reachable:    state == connectivity.Ready,
+				DurationMs:   milliseconds(time.Since(start)),
+			}
+		}(i, peer)
+	}
+	wg.Wait()
+
+	return append(checks, checkChaincode(ctx, org))
+}
+
+// checkChaincode evaluates the chaincode's Ping function as the organization's default identity
+func checkChaincode(ctx context.Context, org string) ReadinessCheck {
+	start := time.Now()
+	check := ReadinessCheck{Name: "chaincode", Organization: org}
+
+	setup, err := gateways.Lookup(org, "")
+	if err == nil {
+		check.Channel, check.Chaincode = setup.ChannelName, setup.ChaincodeName
+		_, err = setup.evaluateTransaction(ctx, pingFunction)
+	}
+	if err != nil {
+		check.Error = err.Error()
+	} else {
+		check.Reachable = true
+	}
+	check.DurationMs = milliseconds(time.Since(start))
+
+	return check
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gatewaypb "github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// pingGateway is a gateway service that answers evaluations of the chaincode's Ping function
+type pingGateway struct {
+	gatewaypb.UnimplementedGatewayServer
+	err error
+}
+
+func (g *pingGateway) Evaluate(context.Context, *gatewaypb.EvaluateRequest) (*gatewaypb.EvaluateResponse, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	return &gatewaypb.EvaluateResponse{Result: &peer.Response{Status: 200, Payload: []byte("pong")}}, nil
+}
+
+// newReadinessRouter serves /readyz for Org1 and Org2, each connected to its own peers
+func newReadinessRouter(t *testing.T, org1Peers, org2Peers []PeerEndpoint) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	wallet := NewInMemoryWallet()
+	putTestIdentity(t, wallet, "Org1", defaultUserName, "Org1MSP")
+	putTestIdentity(t, wallet, "Org2", defaultUserName, "Org2MSP")
+
+	registry := NewGatewayRegistry("Org1", wallet, testConnectionConfig)
+	for org, peers := range map[string][]PeerEndpoint{"Org1": org1Peers, "Org2": org2Peers} {
+		connection, err := NewConnectionManager(org, peers, testConnectionConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		registry.orgs[org] = OrgSetup{OrgName: org, MSPID: org + "MSP", ChannelName: "mychannel", ChaincodeName: "basic"}
+		registry.connections[org] = connection
+	}
+
+	previousGateways, previousTimeouts := gateways, callTimeouts
+	gateways = registry
+	callTimeouts = TimeoutConfig{CallTimeouts: CallTimeouts{Evaluate: time.Second}}
+	t.Cleanup(func() {
+		registry.Close()
+		gateways, callTimeouts = previousGateways, previousTimeouts
+	})
+
+	router := gin.New()
+	router.GET("/readyz", readyz)
+	return router
+}
+
+// getReadiness requests the readiness report
+func getReadiness(t *testing.T, router *gin.Engine) (int, ReadinessReport) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var report ReadinessReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, report
+}
+
+// findCheck returns the readiness check of the organization with the name, and of the peer for peer checks
+func findCheck(t *testing.T, report ReadinessReport, name, org, peerName string) ReadinessCheck {
+	t.Helper()
+	for _, check := range report.Checks {
+		if check.Name == name && check.Organization == org && check.Peer == peerName {
+			return check
+		}
+	}
+	t.Fatalf("no %s check of %s %s in %+v", name, org, peerName, report.Checks)
+	return ReadinessCheck{}
+}
+
+func TestReadyzReportsReady(t *testing.T) {
+	_, address1 := startPeer(t, &pingGateway{})
+	_, address2 := startPeer(t, &pingGateway{})
+	router := newReadinessRouter(t,
+		[]PeerEndpoint{{Name: "peer0.org1", Address: address1}},
+		[]PeerEndpoint{{Name: "peer0.org2", Address: address2}},
+	)
+
+	code, report := getReadiness(t, router)
+	if code != http.StatusOK || report.Status != "ready" {
+		t.Fatalf("expected ready, got %d: %+v", code, report)
+	}
+	if len(report.Checks) != 4 {
+		t.Fatalf("expected a peer and a chaincode check per organization, got %+v", report.Checks)
+	}
+	for _, org := range []string{"Org1", "Org2"} {
+		check := findCheck(t, report, "chaincode", org, "")
+		if !check.Reachable || check.Channel != "mychannel" || check.Chaincode != "basic" {
+			t.Errorf("expected the chaincode of %s to be reachable, got %+v", org, check)
+		}
+	}
+}
+
+func TestReadyzToleratesUnreachablePeer(t *testing.T) {
+	_, address1 := startPeer(t, &pingGateway{})
+	_, address2 := startPeer(t, &pingGateway{})
+	router := newReadinessRouter(t,
+		[]PeerEndpoint{{Name: "peer0.org1", Address: unusedAddress(t)}, {Name: "peer1.org1", Address: address1}},
+		[]PeerEndpoint{{Name: "peer0.org2", Address: address2}},
+	)
+
+	code, report := getReadiness(t, router)
+	if code != http.StatusOK || report.Status != "ready" {
+		t.Fatalf("expected ready while one peer of Org1 is reachable, got %d: %+v", code, report)
+	}
+	if check := findCheck(t, report, "peer", "Org1", "peer0.org1"); check.Reachable {
+		t.Errorf("expected peer0.org1 to be unreachable, got %+v", check)
+	}
+	if check := findCheck(t, report, "peer", "Org1", "peer1.org1"); !check.Reachable {
+		t.Errorf("expected peer1.org1 to be reachable, got %+v", check)
+	}
+}
+
+func TestReadyzReportsNotReady(t *testing.T) {
+	tests := []struct {
+		name    string
+		gateway gatewaypb.GatewayServer
+		peer    bool
+	}{
+		{name: "no reachable peer", peer: false},
+		{name: "chaincode not reachable", gateway: &pingGateway{err: status.Error(codes.Unavailable, "chaincode basic not installed")}, peer: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, address1 := startPeer(t, &pingGateway{})
+			address2 := unusedAddress(t)
+			if tt.peer {
+				_, address2 = startPeer(t, tt.gateway)
+			}
+			router := newReadinessRouter(t,
+				[]PeerEndpoint{{Name: "peer0.org1", Address: address1}},
+				[]PeerEndpoint{{Name: "peer0.org2", Address: address2}},
+			)
+
+			code, report := getReadiness(t, router)
+			if code != http.StatusServiceUnavailable || report.Status != "not ready" {
+				t.Fatalf("expected not ready, got %d: %+v", code, report)
+			}
+			if check := findCheck(t, report, "peer", "Org2", "peer0.org2"); check.Reachable != tt.peer {
+				t.Errorf("expected peer0.org2 reachable %v, got %+v", tt.peer, check)
+			}
+			if check := findCheck(t, report, "chaincode", "Org2", ""); check.Reachable || check.Error == "" {
+				t.Errorf("expected the chaincode of Org2 to fail, got %+v", check)
+			}
+			if check := findCheck(t, report, "chaincode", "Org1", ""); !check.Reachable {
+				t.Errorf("expected the chaincode of Org1 to be reachable, got %+v", check)
+			}
+		})
+	}
+}
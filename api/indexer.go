@@ -0,0 +1,593 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+	_ "modernc.org/sqlite"
+)
+
+// indexerSchema creates the off-chain projection of the asset state. The checkpoint is stored in the
+// same database and updated in the same SQL transaction as each block's writes, so the projection and
+// its checkpoint can never disagree.
+const indexerSchema = `
+CREATE TABLE IF NOT EXISTS assets (
+	id              TEXT PRIMARY KEY,
+	color           TEXT NOT NULL,
+	size            INTEGER NOT NULL,
+	owner           TEXT NOT NULL,
+	appraised_value INTEGER NOT NULL,
+	owner_msp       TEXT NOT NULL,
+	owner_identity  TEXT NOT NULL,
+	created_at      TEXT NOT NULL,
+	updated_at      TEXT NOT NULL,
+	block_number    INTEGER NOT NULL,
+	tx_id           TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS assets_owner ON assets (owner);
+CREATE INDEX IF NOT EXISTS assets_color ON assets (color);
+CREATE TABLE IF NOT EXISTS asset_history (
+	asset_id     TEXT NOT NULL,
+	tx_id        TEXT NOT NULL,
+	action       TEXT NOT NULL,
+	owner        TEXT NOT NULL,
+	timestamp    TEXT NOT NULL,
+	block_number INTEGER NOT NULL,
+	PRIMARY KEY (asset_id, tx_id)
+);
+CREATE TABLE IF NOT EXISTS indexer_checkpoint (
+	id           INTEGER PRIMARY KEY CHECK (id = 1),
+	block_number INTEGER NOT NULL,
+	block_hash   BLOB NOT NULL
+);
+`
+
+// compositeKeyNamespace starts every composite key written by the chaincode
+const compositeKeyNamespace = "\x00"
+
+// errLedgerDiverged is returned when a block does not chain onto the indexed one, meaning the
+// ledger the index was built from has been replaced
+var errLedgerDiverged = errors.New("ledger no longer matches the indexed blocks")
+
+// assetSortColumns maps the sort parameter accepted by ListAssets to its column
+var assetSortColumns = map[string]string{
+	"id":             "id",
+	"color":          "color",
+	"size":           "size",
+	"owner":          "owner",
+	"appraisedValue": "appraised_value",
+	"createdAt":      "created_at",
+	"updatedAt":      "updated_at",
+}
+
+// AssetFilter selects, sorts and pages the assets returned by ListAssets. Zero values are ignored.
+type AssetFilter struct {
+	Owner         string
+	Color         string
+	OwnerMSP      string
+	MinSize       *int
+	MaxSize       *int
+	MinValue      *int
+	MaxValue      *int
+	CreatedAfter  string
+	CreatedBefore string
+	Sort          string
+	Descending    bool
+	Limit         int
+	Offset        int
+}
+
+// IndexerStatus reports how far the indexer is behind the ledger
+type IndexerStatus struct {
+	LastIndexedBlock *uint64 `json:"lastIndexedBlock"`
+	LedgerHeight     uint64  `json:"ledgerHeight"`
+	Lag              uint64  `json:"lag"`
+	CaughtUp         bool    `json:"caughtUp"`
+}
+
+// Indexer projects committed asset and history writes into an SQLite database that serves
+// list queries without range scans on the peer
+type Indexer struct {
+	db            *sql.DB
+	network       *client.Network
+	heights       *LedgerHeightPoller
+	channelName   string
+	chaincodeName string
+	retryDelay    time.Duration
+
+	mu        sync.RWMutex
+	lastBlock *uint64
+	lastHash  []byte
+}
+
+// NewIndexer opens, or creates, the index database at path. The indexer measures its lag against the
+// heights of the poller.
+func NewIndexer(path string, network *client.Network, heights *LedgerHeightPoller, channelName string, chaincodeName string) (*Indexer, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index database: %w", err)
+	}
+	// SQLite allows a single writer; one connection avoids "database is locked" errors
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(indexerSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create index schema: %w", err)
+	}
+
+	// Indexes built before appraisals stopped writing a public hash still have its column
+	var legacyColumns int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('assets') WHERE name = 'appraisal_hash'").Scan(&legacyColumns); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read index schema: %w", err)
+	}
+	if legacyColumns > 0 {
+		if _, err := db.Exec("ALTER TABLE assets DROP COLUMN appraisal_hash"); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to migrate index schema: %w", err)
+		}
+	}
+
+	indexer := &Indexer{
+		db:            db,
+		network:       network,
+		heights:       heights,
+		channelName:   channelName,
+		chaincodeName: chaincodeName,
+		retryDelay:    5 * time.Second,
+	}
+
+	var blockNumber uint64
+	var blockHash []byte
+	err = db.QueryRow("SELECT block_number, block_hash FROM indexer_checkpoint WHERE id = 1").Scan(&blockNumber, &blockHash)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		db.Close()
+		return nil, fmt.Errorf("failed to read index checkpoint: %w", err)
+	default:
+		indexer.lastBlock = &blockNumber
+		indexer.lastHash = blockHash
+	}
+
+	return indexer, nil
+}
+
+// Close closes the index database
+func (ix *Indexer) Close() error {
+	return ix.db.Close()
+}
+
+// Run indexes committed blocks until ctx is done, reconnecting after failures and rebuilding the
+// index from the genesis block when the ledger no longer matches it
+func (ix *Indexer) Run(ctx context.Context) {
+	for {
+		err := ix.follow(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if errors.Is(err, errLedgerDiverged) {
+			log.Printf("Indexer: %v; rebuilding the index", err)
+			if err := ix.reset(); err != nil {
+				log.Printf("Indexer: failed to reset index: %v", err)
+			}
+		} else {
+			log.Printf("Indexer stopped: %v; reconnecting in %s", err, ix.retryDelay)
+		}
+
+		select {
+		case <-time.After(ix.retryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// follow indexes blocks from the one after the checkpoint until the stream fails
+func (ix *Indexer) follow(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lastBlock, _ := ix.checkpoint()
+
+	// A peer behind the index, such as a lagging peer taken over after a failover, is waited for rather than
+	// treated as a new ledger. Only a block that does not chain onto the indexed one makes indexBlock
+	// report the ledger as diverged.
+	height, err := ix.heights.Refresh()
+	if err != nil {
+		return err
+	}
+	if lastBlock != nil && height <= *lastBlock {
+		return fmt.Errorf("peer ledger height %d has not reached the last indexed block %d; waiting for it to catch up", height, *lastBlock)
+	}
+
+	startBlock := uint64(0)
+	if lastBlock != nil {
+		startBlock = *lastBlock + 1
+	}
+	log.Printf("Indexer following channel %s from block %d", ix.channelName, startBlock)
+
+	blocks, err := ix.network.BlockEvents(ctx, client.WithStartBlock(startBlock))
+	if err != nil {
+		return fmt.Errorf("failed to start block event listening: %w", err)
+	}
+
+	for block := range blocks {
+		if err := ix.indexBlock(block); err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("block event stream closed")
+}
+
+// checkpoint returns the last indexed block number and header hash
+func (ix *Indexer) checkpoint() (*uint64, []byte) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return ix.lastBlock, ix.lastHash
+}
+
+// indexBlock applies the valid transactions of the block and advances the checkpoint atomically
+func (ix *Indexer) indexBlock(block *common.Block) error {
+	header := block.GetHeader()
+	lastBlock, lastHash := ix.checkpoint()
+
+	if lastBlock != nil {
+		if header.GetNumber() != *lastBlock+1 {
+			return fmt.Errorf("expected block %d but received block %d", *lastBlock+1, header.GetNumber())
+		}
+		if !bytes.Equal(header.GetPreviousHash(), lastHash) {
+			return fmt.Errorf("%w: block %d does not follow the indexed block %d", errLedgerDiverged, header.GetNumber(), *lastBlock)
+		}
+	}
+
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ix.applyBlock(tx, block); err != nil {
+		return fmt.Errorf("failed to index block %d: %w", header.GetNumber(), err)
+	}
+
+	blockHash := blockHeaderHash(header)
+	_, err = tx.Exec(`INSERT INTO indexer_checkpoint (id, block_number, block_hash) VALUES (1, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET block_number = excluded.block_number, block_hash = excluded.block_hash`,
+		header.GetNumber(), blockHash)
+	if err != nil {
+		return fmt.Errorf("failed to update index checkpoint: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	ix.mu.Lock()
+	blockNumber := header.GetNumber()
+	ix.lastBlock = &blockNumber
+	ix.lastHash = blockHash
+	ix.mu.Unlock()
+
+	return nil
+}
+
+// applyBlock projects the chaincode writes of every valid endorser transaction in the block
+func (ix *Indexer) applyBlock(tx *sql.Tx, block *common.Block) error {
+	var validationCodes []byte
+	if metadata := block.GetMetadata().GetMetadata(); len(metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		validationCodes = metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	for i, envelopeBytes := range block.GetData().GetData() {
+		if i < len(validationCodes) && peer.TxValidationCode(validationCodes[i]) != peer.TxValidationCode_VALID {
+			continue
+		}
+
+		envelope := &common.Envelope{}
+		if err := proto.Unmarshal(envelopeBytes, envelope); err != nil {
+			return err
+		}
+		payload := &common.Payload{}
+		if err := proto.Unmarshal(envelope.GetPayload(), payload); err != nil {
+			return err
+		}
+		channelHeader := &common.ChannelHeader{}
+		if err := proto.Unmarshal(payload.GetHeader().GetChannelHeader(), channelHeader); err != nil {
+			return err
+		}
+		if common.HeaderType(channelHeader.GetType()) != common.HeaderType_ENDORSER_TRANSACTION {
+			continue
+		}
+
+		writes, err := ix.chaincodeWrites(payload.GetData())
+		if err != nil {
+			return fmt.Errorf("failed to read transaction %s: %w", channelHeader.GetTxId(), err)
+		}
+		for _, write := range writes {
+			if err := applyWrite(tx, block.GetHeader().GetNumber(), channelHeader.GetTxId(), write); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// chaincodeWrites extracts the writes to the indexed chaincode's namespace from a transaction
+func (ix *Indexer) chaincodeWrites(transactionBytes []byte) ([]*kvrwset.KVWrite, error) {
+	transaction := &peer.Transaction{}
+	if err := proto.Unmarshal(transactionBytes, transaction); err != nil {
+		return nil, err
+	}
+
+	var writes []*kvrwset.KVWrite
+	for _, action := range transaction.GetActions() {
+		actionPayload := &peer.ChaincodeActionPayload{}
+		if err := proto.Unmarshal(action.GetPayload(), actionPayload); err != nil {
+			return nil, err
+		}
+		responsePayload := &peer.ProposalResponsePayload{}
+		if err := proto.Unmarshal(actionPayload.GetAction().GetProposalResponsePayload(), responsePayload); err != nil {
+			return nil, err
+		}
+		chaincodeAction := &peer.ChaincodeAction{}
+		if err := proto.Unmarshal(responsePayload.GetExtension(), chaincodeAction); err != nil {
+			return nil, err
+		}
+		txReadWriteSet := &rwset.TxReadWriteSet{}
+		if err := proto.Unmarshal(chaincodeAction.GetResults(), txReadWriteSet); err != nil {
+			return nil, err
+		}
+
+		for _, namespaceSet := range txReadWriteSet.GetNsRwset() {
+			if namespaceSet.GetNamespace() != ix.chaincodeName {
+				continue
+			}
+			kvReadWriteSet := &kvrwset.KVRWSet{}
+			if err := proto.Unmarshal(namespaceSet.GetRwset(), kvReadWriteSet); err != nil {
+				return nil, err
+			}
+			writes = append(writes, kvReadWriteSet.GetWrites()...)
+		}
+	}
+
+	return writes, nil
+}
+
+// applyWrite projects a single key write: assets are upserted or deleted, history records are
+// appended and all other keys, such as the owner index, are ignored
+func applyWrite(tx *sql.Tx, blockNumber uint64, txID string, write *kvrwset.KVWrite) error {
+	key := write.GetKey()
+
+	if strings.HasPrefix(key, compositeKeyNamespace) {
+		parts := strings.Split(strings.TrimPrefix(key, compositeKeyNamespace), compositeKeyNamespace)
+		if parts[0] != "history" || write.GetIsDelete() {
+			return nil
+		}
+		return insertHistory(tx, blockNumber, write.GetValue())
+	}
+
+	// History records written before the composite key layout
+	if strings.HasPrefix(key, "HISTORY_") {
+		if write.GetIsDelete() {
+			return nil
+		}
+		return insertHistory(tx, blockNumber, write.GetValue())
+	}
+
+	if write.GetIsDelete() {
+		_, err := tx.Exec("DELETE FROM assets WHERE id = ?", key)
+		return err
+	}
+
+	var asset Asset
+	if err := json.Unmarshal(write.GetValue(), &asset); err != nil {
+		return fmt.Errorf("failed to parse asset %s: %w", key, err)
+	}
+	_, err := tx.Exec(`INSERT INTO assets (id, color, size, owner, appraised_value, owner_msp, owner_identity, created_at, updated_at, block_number, tx_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET color = excluded.color, size = excluded.size, owner = excluded.owner,
+			appraised_value = excluded.appraised_value, owner_msp = excluded.owner_msp, owner_identity = excluded.owner_identity,
+			created_at = excluded.created_at, updated_at = excluded.updated_at, block_number = excluded.block_number,
+			tx_id = excluded.tx_id`,
+		key, asset.Color, asset.Size, asset.Owner, asset.AppraisedValue, asset.OwnerMSP, asset.OwnerIdentity,
+		asset.CreatedAt, asset.UpdatedAt, blockNumber, txID)
+	return err
+}
+
+// insertHistory stores a history record written by the chaincode
+func insertHistory(tx *sql.Tx, blockNumber uint64, value []byte) error {
+	var history AssetHistory
+	if err := json.Unmarshal(value, &history); err != nil {
+		return fmt.Errorf("failed to parse history record: %w", err)
+	}
+
+	_, err := tx.Exec(`INSERT OR REPLACE INTO asset_history (asset_id, tx_id, action, owner, timestamp, block_number)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		history.AssetID, history.TxID, history.Action, history.Owner, history.Timestamp, blockNumber)
+	return err
+}
+
+// reset drops all indexed data so the index is rebuilt from the genesis block
+func (ix *Indexer) reset() error {
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"assets", "asset_history", "indexer_checkpoint"} {
+		if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	ix.mu.Lock()
+	ix.lastBlock = nil
+	ix.lastHash = nil
+	ix.mu.Unlock()
+
+	return nil
+}
+
+// blockHeaderHash computes the hash by which the next block refers to this one
+func blockHeaderHash(header *common.BlockHeader) []byte {
+	headerBytes, err := asn1.Marshal(struct {
+		Number       *big.Int
+		PreviousHash []byte
+		DataHash     []byte
+	}{
+		Number:       new(big.Int).SetUint64(header.GetNumber()),
+		PreviousHash: header.GetPreviousHash(),
+		DataHash:     header.GetDataHash(),
+	})
+	if err != nil {
+		// Marshalling a big.Int and two byte slices cannot fail
+		panic(err)
+	}
+
+	hash := sha256.Sum256(headerBytes)
+	return hash[:]
+}
+
+// Status reports the last indexed block and how many blocks the index is behind the ledger
+func (ix *Indexer) Status() IndexerStatus {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	ledgerHeight := ix.heights.Height()
+	status := IndexerStatus{LedgerHeight: ledgerHeight}
+	indexedHeight := uint64(0)
+	if ix.lastBlock != nil {
+		lastBlock := *ix.lastBlock
+		status.LastIndexedBlock = &lastBlock
+		indexedHeight = lastBlock + 1
+	}
+	if ledgerHeight > indexedHeight {
+		status.Lag = ledgerHeight - indexedHeight
+	}
+	status.CaughtUp = ledgerHeight > 0 && status.Lag == 0
+
+	return status
+}
+
+// CaughtUp refreshes the ledger height from the peer and reports whether every committed block has been
+// indexed. The height Status uses is only polled periodically, so it may not include a block just committed.
+func (ix *Indexer) CaughtUp() bool {
+	if _, err := ix.heights.Refresh(); err != nil {
+		log.Printf("Indexer: %v", err)
+		return false
+	}
+	return ix.Status().CaughtUp
+}
+
+// ListAssets returns the indexed assets matching the filter, together with the total number of
+// matches before limit and offset are applied
+func (ix *Indexer) ListAssets(filter AssetFilter) ([]Asset, int, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+
+	if filter.Owner != "" {
+		addCondition("owner = ?", filter.Owner)
+	}
+	if filter.Color != "" {
+		addCondition("color = ?", filter.Color)
+	}
+	if filter.OwnerMSP != "" {
+		addCondition("owner_msp = ?", filter.OwnerMSP)
+	}
+	if filter.MinSize != nil {
+		addCondition("size >= ?", *filter.MinSize)
+	}
+	if filter.MaxSize != nil {
+		addCondition("size <= ?", *filter.MaxSize)
+	}
+	// Like QueryAssetsByAppraisedValueRange, a value range never matches assets that publish no value
+	if filter.MinValue != nil || filter.MaxValue != nil {
+		addCondition("appraised_value > ?", 0)
+	}
+	if filter.MinValue != nil {
+		addCondition("appraised_value >= ?", *filter.MinValue)
+	}
+	if filter.MaxValue != nil {
+		addCondition("appraised_value <= ?", *filter.MaxValue)
+	}
+	if filter.CreatedAfter != "" {
+		addCondition("created_at >= ?", filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != "" {
+		addCondition("created_at <= ?", filter.CreatedBefore)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := ix.db.QueryRow("SELECT COUNT(*) FROM assets"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count assets: %w", err)
+	}
+
+	sortColumn, ok := assetSortColumns[filter.Sort]
+	if !ok {
+		sortColumn = "id"
+	}
+	order := "ASC"
+	if filter.Descending {
+		order = "DESC"
+	}
+	query := fmt.Sprintf(`SELECT id, color, size, owner, appraised_value, owner_msp, owner_identity, created_at, updated_at
+		FROM assets%s ORDER BY %s %s, id ASC LIMIT ? OFFSET ?`, where, sortColumn, order)
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = -1 // No limit
+	}
+	rows, err := ix.db.Query(query, append(args, limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list assets: %w", err)
+	}
+	defer rows.Close()
+
+	assets := []Asset{}
+	for rows.Next() {
+		var asset Asset
+		err := rows.Scan(&asset.ID, &asset.Color, &asset.Size, &asset.Owner, &asset.AppraisedValue, &asset.OwnerMSP,
+			&asset.OwnerIdentity, &asset.CreatedAt, &asset.UpdatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		assets = append(assets, asset)
+	}
+
+	return assets, total, rows.Err()
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+)
+
+// newTestIndexer opens an index in a temporary directory, without a network to follow
+func newTestIndexer(t *testing.T) (*Indexer, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "indexer.db")
+	ix, err := NewIndexer(path, nil, &LedgerHeightPoller{}, "mychannel", "basic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ix.Close() })
+	return ix, path
+}
+
+// applyWrites projects the writes of a transaction into the index
+func applyWrites(t *testing.T, ix *Indexer, blockNumber uint64, txID string, writes ...*kvrwset.KVWrite) {
+	t.Helper()
+	tx, err := ix.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for _, write := range writes {
+		if err := applyWrite(tx, blockNumber, txID, write); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// historyWrite returns a history record written under key
+func historyWrite(t *testing.T, key string, history AssetHistory) *kvrwset.KVWrite {
+	t.Helper()
+	value, err := json.Marshal(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &kvrwset.KVWrite{Key: key, Value: value}
+}
+
+// countRows returns the number of rows in the table
+func countRows(t *testing.T, ix *Indexer, table string) int {
+	t.Helper()
+	var count int
+	if err := ix.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// chainedBlock returns an empty block that follows previous, or the genesis block when previous is nil
+func chainedBlock(previous *common.Block) *common.Block {
+	header := &common.BlockHeader{DataHash: []byte("data")}
+	if previous != nil {
+		header.Number = previous.GetHeader().GetNumber() + 1
+		header.PreviousHash = blockHeaderHash(previous.GetHeader())
+	}
+	return &common.Block{Header: header, Data: &common.BlockData{}}
+}
+
+// assetWrite returns the write of the asset as found in a block's read-write set
+func assetWrite(t *testing.T, asset Asset) *kvrwset.KVWrite {
+	t.Helper()
+	value, err := json.Marshal(asset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &kvrwset.KVWrite{Key: asset.ID, Value: value}
+}
+
+func TestNewIndexerDropsLegacyAppraisalHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "indexer.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE assets (
+		id TEXT PRIMARY KEY, color TEXT NOT NULL, size INTEGER NOT NULL, owner TEXT NOT NULL,
+		appraised_value INTEGER NOT NULL, owner_msp TEXT NOT NULL, owner_identity TEXT NOT NULL,
+		appraisal_hash TEXT NOT NULL, created_at TEXT NOT NULL, updated_at TEXT NOT NULL,
+		block_number INTEGER NOT NULL, tx_id TEXT NOT NULL)`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ix, err := NewIndexer(path, nil, nil, "mychannel", "basic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+
+	tx, err := ix.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := applyWrite(tx, 1, "tx1", assetWrite(t, Asset{ID: "asset1", Color: "blue", Size: 5, Owner: "Tomoko"})); err != nil {
+		t.Fatalf("writing to the migrated index failed: %v", err)
+	}
+}
+
+func TestApplyWriteProjectsAssets(t *testing.T) {
+	ix, _ := newTestIndexer(t)
+
+	applyWrites(t, ix, 1, "tx1",
+		assetWrite(t, Asset{ID: "asset1", Color: "blue", Size: 5, Owner: "Tomoko", AppraisedValue: 300}),
+		assetWrite(t, Asset{ID: "asset2", Color: "red", Size: 10, Owner: "Brad"}),
+	)
+	applyWrites(t, ix, 2, "tx2",
+		assetWrite(t, Asset{ID: "asset1", Color: "blue", Size: 5, Owner: "Jin Soo", AppraisedValue: 300}),
+		&kvrwset.KVWrite{Key: "asset2", IsDelete: true},
+		// The owner index is not projected
+		&kvrwset.KVWrite{Key: "\x00owner~assetID\x00Jin Soo\x00asset1\x00", Value: []byte{0x00}},
+	)
+
+	assets, total, err := ix.ListAssets(AssetFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Asset{{ID: "asset1", Color: "blue", Size: 5, Owner: "Jin Soo", AppraisedValue: 300}}
+	if total != 1 || !reflect.DeepEqual(assets, want) {
+		t.Fatalf("expected %+v, got %d assets: %+v", want, total, assets)
+	}
+}
+
+func TestApplyWriteProjectsHistory(t *testing.T) {
+	ix, _ := newTestIndexer(t)
+
+	applyWrites(t, ix, 1, "tx1",
+		historyWrite(t, "\x00history\x00asset1\x00tx1\x00", AssetHistory{AssetID: "asset1", Action: "CREATE", Owner: "Tomoko", TxID: "tx1"}),
+		historyWrite(t, "HISTORY_asset1_tx0", AssetHistory{AssetID: "asset1", Action: "CREATE", Owner: "Tomoko", TxID: "tx0"}),
+		// Deleting a history key leaves the indexed record in place
+		&kvrwset.KVWrite{Key: "\x00history\x00asset1\x00tx1\x00", IsDelete: true},
+	)
+
+	rows, err := ix.db.Query("SELECT tx_id, action, block_number FROM asset_history WHERE asset_id = ? ORDER BY tx_id", "asset1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var txIDs []string
+	for rows.Next() {
+		var txID, action string
+		var blockNumber uint64
+		if err := rows.Scan(&txID, &action, &blockNumber); err != nil {
+			t.Fatal(err)
+		}
+		if action != "CREATE" || blockNumber != 1 {
+			t.Errorf("%s: unexpected action %s in block %d", txID, action, blockNumber)
+		}
+		txIDs = append(txIDs, txID)
+	}
+	if want := []string{"tx0", "tx1"}; !reflect.DeepEqual(txIDs, want) {
+		t.Fatalf("expected history records %v, got %v", want, txIDs)
+	}
+}
+
+func TestIndexBlockDetectsDivergedLedger(t *testing.T) {
+	ix, path := newTestIndexer(t)
+
+	genesis := chainedBlock(nil)
+	next := chainedBlock(genesis)
+	for _, block := range []*common.Block{genesis, next} {
+		if err := ix.indexBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	applyWrites(t, ix, 1, "tx1", assetWrite(t, Asset{ID: "asset1", Color: "blue", Size: 5, Owner: "Tomoko"}))
+
+	// The checkpoint survives a restart
+	reopened, err := NewIndexer(path, nil, &LedgerHeightPoller{}, "mychannel", "basic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastBlock, lastHash := reopened.checkpoint()
+	reopened.Close()
+	if lastBlock == nil || *lastBlock != 1 || !reflect.DeepEqual(lastHash, blockHeaderHash(next.GetHeader())) {
+		t.Fatalf("expected the checkpoint at block 1, got %v", lastBlock)
+	}
+
+	// A block 2 from a recreated network does not chain onto the indexed block 1
+	diverged := chainedBlock(chainedBlock(&common.Block{Header: &common.BlockHeader{DataHash: []byte("other")}}))
+	if err := ix.indexBlock(diverged); !errors.Is(err, errLedgerDiverged) {
+		t.Fatalf("expected errLedgerDiverged, got %v", err)
+	}
+
+	if err := ix.reset(); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"assets", "asset_history", "indexer_checkpoint"} {
+		if count := countRows(t, ix, table); count != 0 {
+			t.Errorf("expected %s to be empty after the reset, got %d rows", table, count)
+		}
+	}
+	if lastBlock, _ := ix.checkpoint(); lastBlock != nil {
+		t.Fatalf("expected no checkpoint after the reset, got block %d", *lastBlock)
+	}
+
+	// The rebuilt index accepts the new ledger from its genesis block
+	if err := ix.indexBlock(chainedBlock(nil)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexerStatusMeasuresLag(t *testing.T) {
+	ix, _ := newTestIndexer(t)
+	ix.heights.height = 3
+
+	if status := ix.Status(); status.CaughtUp || status.Lag != 3 || status.LastIndexedBlock != nil {
+		t.Fatalf("expected an empty index to lag 3 blocks, got %+v", status)
+	}
+
+	block := chainedBlock(nil)
+	for i := 0; i < 3; i++ {
+		if err := ix.indexBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		block = chainedBlock(block)
+	}
+	if status := ix.Status(); !status.CaughtUp || status.Lag != 0 {
+		t.Fatalf("expected the index to have caught up, got %+v", status)
+	}
+}
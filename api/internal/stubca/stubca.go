@@ -0,0 +1,298 @@
+// Package stubca implements the register and enroll endpoints of the Fabric CA REST API, enough to try
+// the API's identity management without running a Fabric CA. It signs certificates with a generated CA
+// key, or with an organization's CA certificate and key so that the peers accept the enrolled identities.
+package stubca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// user is a registered identity
+type user struct {
+	secret string
+	kind   string
+}
+
+// CA issues certificates to registered users
+type CA struct {
+	mu          sync.Mutex
+	users       map[string]*user
+	certificate *x509.Certificate
+	key         crypto.Signer
+}
+
+// AddRegistrar registers a bootstrap identity that may register other users
+func (ca *CA) AddRegistrar(id, secret string) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	ca.users[id] = &user{secret: secret, kind: "admin"}
+}
+
+// Handler serves the register and enroll endpoints
+func (ca *CA) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/register", ca.register)
+	mux.HandleFunc("/api/v1/enroll", ca.enroll)
+	return mux
+}
+
+// New loads the CA certificate and key, or generates a self-signed CA when no paths are given
+func New(certPath, keyPath string) (*CA, error) {
+	ca := &CA{users: make(map[string]*user)}
+
+	if certPath == "" {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "stub-ca"},
+			NotBefore:             time.Now().Add(-time.Minute),
+			NotAfter:              time.Now().AddDate(1, 0, 0),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			return nil, err
+		}
+		ca.certificate, err = x509.ParseCertificate(der)
+		ca.key = key
+		return ca, err
+	}
+
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("%s holds no PEM certificate", certPath)
+	}
+	ca.certificate, err = x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ = pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("%s holds no PEM private key", keyPath)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s holds no signing key", keyPath)
+	}
+	ca.key = signer
+
+	return ca, nil
+}
+
+// register registers a user on behalf of a registrar authenticated by a Fabric CA token
+func (ca *CA) register(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	var req struct {
+		ID     string `json:"id"`
+		Type   string `json:"type"`
+		Secret string `json:"secret"`
+	}
+	if err := readJSON(r, &body, &req); err != nil || req.ID == "" {
+		respond(w, http.StatusBadRequest, nil, "request must be JSON with an id")
+		return
+	}
+
+	registrar, err := ca.verifyToken(r.Header.Get("Authorization"), r.Method, r.URL.RequestURI(), body)
+	if err != nil {
+		respond(w, http.StatusUnauthorized, nil, err.Error())
+		return
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if u, ok := ca.users[registrar]; !ok || u.kind != "admin" {
+		respond(w, http.StatusUnauthorized, nil, fmt.Sprintf("%s is not a registrar", registrar))
+		return
+	}
+	if _, ok := ca.users[req.ID]; ok {
+		respond(w, http.StatusConflict, nil, fmt.Sprintf("identity %s is already registered", req.ID))
+		return
+	}
+
+	if req.Secret == "" {
+		secret := make([]byte, 12)
+		rand.Read(secret)
+		req.Secret = base64.RawURLEncoding.EncodeToString(secret)
+	}
+	if req.Type == "" {
+		req.Type = "client"
+	}
+	ca.users[req.ID] = &user{secret: req.Secret, kind: req.Type}
+	log.Printf("Registered %s (%s) on behalf of %s", req.ID, req.Type, registrar)
+
+	respond(w, http.StatusCreated, map[string]string{"secret": req.Secret}, "")
+}
+
+// enroll signs the certificate request of a user authenticated by enrollment ID and secret
+func (ca *CA) enroll(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	var req struct {
+		CertificateRequest string `json:"certificate_request"`
+	}
+	if err := readJSON(r, &body, &req); err != nil {
+		respond(w, http.StatusBadRequest, nil, "request must be JSON with a certificate_request")
+		return
+	}
+
+	id, secret, ok := r.BasicAuth()
+	ca.mu.Lock()
+	u, registered := ca.users[id]
+	ca.mu.Unlock()
+	if !ok || !registered || u.secret != secret {
+		respond(w, http.StatusUnauthorized, nil, "invalid enrollment ID or secret")
+		return
+	}
+
+	block, _ := pem.Decode([]byte(req.CertificateRequest))
+	if block == nil {
+		respond(w, http.StatusBadRequest, nil, "certificate_request is not PEM")
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		respond(w, http.StatusBadRequest, nil, fmt.Sprintf("invalid certificate request: %v", err))
+		return
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		respond(w, http.StatusInternalServerError, nil, err.Error())
+		return
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		// Fabric MSPs with NodeOUs enabled classify identities by their OU
+		Subject:   pkix.Name{CommonName: id, OrganizationalUnit: []string{u.kind}},
+		NotBefore: time.Now().Add(-time.Minute),
+		NotAfter:  time.Now().AddDate(1, 0, 0),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, csr.PublicKey, ca.key)
+	if err != nil {
+		respond(w, http.StatusInternalServerError, nil, err.Error())
+		return
+	}
+	log.Printf("Enrolled %s", id)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.certificate.Raw})
+	respond(w, http.StatusCreated, map[string]interface{}{
+		"Cert": base64.StdEncoding.EncodeToString(certPEM),
+		"ServerInfo": map[string]string{
+			"CAName":  "stub-ca",
+			"CAChain": base64.StdEncoding.EncodeToString(caPEM),
+		},
+	}, "")
+}
+
+// verifyToken checks a Fabric CA token and returns the common name of the certificate that signed it,
+// which must have been issued by this CA
+func (ca *CA) verifyToken(token, method, uri string, body []byte) (string, error) {
+	encodedCert, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", errors.New("missing or malformed authorization token")
+	}
+
+	certPEM, err := base64.StdEncoding.DecodeString(encodedCert)
+	if err != nil {
+		return "", errors.New("malformed token certificate")
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return "", errors.New("malformed token certificate")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("malformed token certificate: %v", err)
+	}
+	if err := certificate.CheckSignatureFrom(ca.certificate); err != nil {
+		return "", errors.New("token certificate was not issued by this CA")
+	}
+	signature, err := base64.StdEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return "", errors.New("malformed token signature")
+	}
+
+	payload := method + "." + base64.StdEncoding.EncodeToString([]byte(uri)) + "." +
+		base64.StdEncoding.EncodeToString(body) + "." + encodedCert
+	digest := sha256.Sum256([]byte(payload))
+	publicKey, ok := certificate.PublicKey.(*ecdsa.PublicKey)
+	if !ok || !ecdsa.VerifyASN1(publicKey, digest[:], signature) {
+		return "", errors.New("invalid token signature")
+	}
+
+	return certificate.Subject.CommonName, nil
+}
+
+// readJSON reads the request body into raw and decodes it into v
+func readJSON(r *http.Request, raw *[]byte, v interface{}) error {
+	if r.Method != http.MethodPost {
+		return errors.New("method not allowed")
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	*raw = data
+	return json.Unmarshal(data, v)
+}
+
+// respond writes a response in the Fabric CA envelope
+func respond(w http.ResponseWriter, status int, result interface{}, message string) {
+	response := map[string]interface{}{
+		"success":  message == "",
+		"result":   result,
+		"errors":   []interface{}{},
+		"messages": []interface{}{},
+	}
+	if message != "" {
+		response["errors"] = []interface{}{map[string]interface{}{"code": status, "message": message}}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
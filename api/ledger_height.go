@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"google.golang.org/protobuf/proto"
+)
+
+// LedgerHeightPoller keeps the channel height up to date for the block listener and the indexer,
+// which both report how far they are behind the ledger
+type LedgerHeightPoller struct {
+	network     *client.Network
+	channelName string
+	interval    time.Duration
+	handlers    []func(height uint64)
+
+	mu     sync.RWMutex
+	height uint64
+}
+
+// NewLedgerHeightPoller creates a poller of the channel height of the network
+func NewLedgerHeightPoller(network *client.Network, channelName string) *LedgerHeightPoller {
+	return &LedgerHeightPoller{
+		network:     network,
+		channelName: channelName,
+		interval:    10 * time.Second,
+	}
+}
+
+// OnHeight registers a handler called with every polled height. Handlers must be registered before Run.
+func (p *LedgerHeightPoller) OnHeight(handler func(height uint64)) {
+	p.handlers = append(p.handlers, handler)
+}
+
+// Height returns the last polled channel height, 0 until the first query succeeds
+func (p *LedgerHeightPoller) Height() uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.height
+}
+
+// Refresh queries the channel height from the peer's query system chaincode and records it
+func (p *LedgerHeightPoller) Refresh() (uint64, error) {
+	output, err := p.network.GetContract("qscc").EvaluateTransaction("GetChainInfo", p.channelName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query ledger height: %w", err)
+	}
+
+	info := &common.BlockchainInfo{}
+	if err := proto.Unmarshal(output, info); err != nil {
+		return 0, fmt.Errorf("failed to parse chain info: %w", err)
+	}
+
+	p.mu.Lock()
+	p.height = info.GetHeight()
+	p.mu.Unlock()
+
+	for _, handler := range p.handlers {
+		handler(info.GetHeight())
+	}
+
+	return info.GetHeight(), nil
+}
+
+// Run polls the channel height until ctx is done
+func (p *LedgerHeightPoller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.Refresh(); err != nil {
+			log.Printf("Ledger height poller: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	gatewaypb "github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// chainInfoGateway is a gateway service that answers the query system chaincode's GetChainInfo
+type chainInfoGateway struct {
+	gatewaypb.UnimplementedGatewayServer
+	height uint64
+	err    error
+}
+
+func (g *chainInfoGateway) Evaluate(context.Context, *gatewaypb.EvaluateRequest) (*gatewaypb.EvaluateResponse, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	payload, err := proto.Marshal(&common.BlockchainInfo{Height: g.height})
+	if err != nil {
+		return nil, err
+	}
+	return &gatewaypb.EvaluateResponse{Result: &peer.Response{Status: 200, Payload: payload}}, nil
+}
+
+// newTestGateway connects Org1's default identity through a local peer serving the gateway
+func newTestGateway(t *testing.T, gateway gatewaypb.GatewayServer) *client.Gateway {
+	t.Helper()
+	_, address := startPeer(t, gateway)
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	wallet := NewInMemoryWallet()
+	putTestIdentity(t, wallet, "Org1", defaultUserName, "Org1MSP")
+	id, err := wallet.Get(walletLabel("Org1", defaultUserName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientIdentity, err := id.newIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign, err := id.newSign()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gw, err := client.Connect(clientIdentity, client.WithSign(sign), client.WithClientConnection(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gw.Close() })
+	return gw
+}
+
+func TestLedgerHeightPollerRefresh(t *testing.T) {
+	gateway := &chainInfoGateway{height: 7}
+	poller := NewLedgerHeightPoller(newTestGateway(t, gateway).GetNetwork("mychannel"), "mychannel")
+
+	var polled []uint64
+	poller.OnHeight(func(height uint64) { polled = append(polled, height) })
+
+	if height, err := poller.Refresh(); err != nil || height != 7 {
+		t.Fatalf("expected height 7, got %d: %v", height, err)
+	}
+	if poller.Height() != 7 || len(polled) != 1 || polled[0] != 7 {
+		t.Fatalf("expected height 7 to be recorded and handed to the handler, got %d and %v", poller.Height(), polled)
+	}
+
+	// A failed query keeps the last height and calls no handler
+	gateway.err = status.Error(codes.Unavailable, "peer unavailable")
+	if _, err := poller.Refresh(); err == nil {
+		t.Fatal("expected the failed query to be reported")
+	}
+	if poller.Height() != 7 || len(polled) != 1 {
+		t.Fatalf("expected height 7 to be kept, got %d and %v", poller.Height(), polled)
+	}
+}
+
+func TestBlockListenerReportsLagOnPolledHeight(t *testing.T) {
+	gateway := &chainInfoGateway{height: 10}
+	network := newTestGateway(t, gateway).GetNetwork("mychannel")
+	poller := NewLedgerHeightPoller(network, "mychannel")
+
+	checkpointer, err := NewFileCheckpointer(filepath.Join(t.TempDir(), "checkpoint.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := NewBlockListener(network, checkpointer, poller)
+	lag := listenerBlockLag.WithLabelValues("mychannel")
+
+	// Without a checkpoint the listener has nothing to measure from
+	if _, err := poller.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if value := gaugeValue(t, lag); value != 0 {
+		t.Fatalf("expected no lag without a checkpoint, got %v", value)
+	}
+
+	if err := checkpointer.CheckpointBlock(6); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := poller.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	// Blocks 7 to 9 are committed but not processed yet
+	if value := gaugeValue(t, lag); value != 3 {
+		t.Fatalf("expected a lag of 3 blocks, got %v", value)
+	}
+
+	// Processing blocks reduces the lag without waiting for the next poll
+	for number := uint64(7); number < 10; number++ {
+		if err := listener.processBlock(filteredBlock(number, "tx"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if value := gaugeValue(t, lag); value != 0 {
+		t.Fatalf("expected the listener to have caught up, got a lag of %v", value)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+)
+
+// TransactionHandler processes one transaction of a committed block.
+// Returning an error stops the listener before the transaction is checkpointed, so it is delivered again;
+// a handler may also see the transactions of a block again if the API stops before the block is checkpointed.
+type TransactionHandler func(blockNumber uint64, transaction *peer.FilteredTransaction) error
+
+// BlockListener follows committed blocks and hands every transaction to its handlers, resuming from its
+// checkpoint after a restart or a dropped connection
+type BlockListener struct {
+	network      *client.Network
+	channelName  string
+	checkpointer *FileCheckpointer
+	heights      *LedgerHeightPoller
+	handlers     []TransactionHandler
+	retryDelay   time.Duration
+}
+
+// NewBlockListener creates a listener on the network that persists its progress with the checkpointer.
+// The listener reports its lag whenever the poller polls a new height.
+func NewBlockListener(network *client.Network, checkpointer *FileCheckpointer, heights *LedgerHeightPoller) *BlockListener {
+	l := &BlockListener{
+		network:      network,
+		channelName:  network.Name(),
+		checkpointer: checkpointer,
+		heights:      heights,
+		retryDelay:   5 * time.Second,
+	}
+	heights.OnHeight(func(uint64) { l.reportLag() })
+	return l
+}
+
+// OnTransaction registers a handler for committed transactions. Handlers must be registered before Run.
+func (l *BlockListener) OnTransaction(handler TransactionHandler) {
+	l.handlers = append(l.handlers, handler)
+}
+
+// Run listens until ctx is done, reconnecting from the last checkpoint whenever the event stream ends
+func (l *BlockListener) Run(ctx context.Context) {
+	for {
+		err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Block listener stopped: %v; reconnecting in %s", err, l.retryDelay)
+
+		select {
+		case <-time.After(l.retryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// listen processes blocks from the checkpoint until the stream fails or ctx is done
+func (l *BlockListener) listen(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	checkpoint := l.checkpointer.Checkpoint()
+
+	var options []client.BlockEventsOption
+	if checkpoint != nil {
+		options = append(options, client.WithStartBlock(checkpoint.BlockNumber))
+		log.Printf("Block listener resuming from block %d", checkpoint.BlockNumber)
+	} else {
+		log.Println("Block listener starting from the next committed block")
+	}
+
+	blocks, err := l.network.FilteredBlockEvents(ctx, options...)
+	if err != nil {
+		return fmt.Errorf("failed to start block event listening: %w", err)
+	}
+
+	for block := range blocks {
+		if err := l.processBlock(block, checkpoint); err != nil {
+			return err
+		}
+		checkpoint = nil
+	}
+
+	return fmt.Errorf("block event stream closed")
+}
+
+// processBlock hands the block's transactions to the handlers, skipping those already covered by
+// the checkpoint. The checkpoint is saved once the whole block has been processed. Only when a handler
+// fails is it saved within the block, so the retry resumes after the transactions already processed.
+func (l *BlockListener) processBlock(block *peer.FilteredBlock, checkpoint *Checkpoint) error {
+	blockNumber := block.GetNumber()
+	transactions := block.GetFilteredTransactions()
+
+	// On resume, skip transactions of the checkpointed block up to and including the last processed one
+	if checkpoint != nil && checkpoint.BlockNumber == blockNumber && checkpoint.TransactionID != "" {
+		for i, transaction := range transactions {
+			if transaction.GetTxid() == checkpoint.TransactionID {
+				transactions = transactions[i+1:]
+				break
+			}
+		}
+	}
+
+	processed := ""
+	for _, transaction := range transactions {
+		for _, handler := range l.handlers {
+			if err := handler(blockNumber, transaction); err != nil {
+				err = fmt.Errorf("failed to process transaction %s in block %d: %w", transaction.GetTxid(), blockNumber, err)
+				if processed != "" {
+					if checkpointErr := l.checkpointer.CheckpointTransaction(blockNumber, processed); checkpointErr != nil {
+						log.Printf("Block listener: %v", checkpointErr)
+					}
+				}
+				return err
+			}
+		}
+
+		processed = transaction.GetTxid()
+		committedTransactions.WithLabelValues(l.channelName, transaction.GetTxValidationCode().String()).Inc()
+	}
+
+	if err := l.checkpointer.CheckpointBlock(blockNumber); err != nil {
+		return err
+	}
+	l.reportLag()
+
+	return nil
+}
+
+// reportLag publishes how many committed blocks the listener has not processed yet, measured from the
+// checkpoint, which points at the next block to process. Without a checkpoint the lag is reported as 0.
+func (l *BlockListener) reportLag() {
+	lag := uint64(0)
+	height := l.heights.Height()
+	if checkpoint := l.checkpointer.Checkpoint(); checkpoint != nil && height > checkpoint.BlockNumber {
+		lag = height - checkpoint.BlockNumber
+	}
+	listenerBlockLag.WithLabelValues(l.channelName).Set(float64(lag))
+}
+
+// logTransaction is the default handler, recording each committed transaction and its validation code
+func logTransaction(blockNumber uint64, transaction *peer.FilteredTransaction) error {
+	log.Printf("Block %d: transaction %s committed with status %s", blockNumber, transaction.GetTxid(), transaction.GetTxValidationCode())
+	return nil
+}
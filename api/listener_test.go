@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+)
+
+// newTestListener creates a listener without a network, checkpointing to path
+func newTestListener(t *testing.T, path string) *BlockListener {
+	t.Helper()
+	checkpointer, err := NewFileCheckpointer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &BlockListener{channelName: "mychannel", checkpointer: checkpointer, heights: &LedgerHeightPoller{}}
+}
+
+// filteredBlock builds a block with the given transaction IDs
+func filteredBlock(number uint64, txids ...string) *peer.FilteredBlock {
+	block := &peer.FilteredBlock{Number: number}
+	for _, txid := range txids {
+		block.FilteredTransactions = append(block.FilteredTransactions, &peer.FilteredTransaction{Txid: txid, TxValidationCode: peer.TxValidationCode_VALID})
+	}
+	return block
+}
+
+// storedCheckpoint reads the checkpoint as persisted on disk
+func storedCheckpoint(t *testing.T, path string) *Checkpoint {
+	t.Helper()
+	checkpointer, err := NewFileCheckpointer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return checkpointer.Checkpoint()
+}
+
+func TestBlockListenerCheckpointsOncePerBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	listener := newTestListener(t, path)
+
+	var stored []*Checkpoint
+	listener.OnTransaction(func(uint64, *peer.FilteredTransaction) error {
+		stored = append(stored, storedCheckpoint(t, path))
+		return nil
+	})
+
+	if err := listener.processBlock(filteredBlock(5, "a", "b", "c"), nil); err != nil {
+		t.Fatal(err)
+	}
+	for i, checkpoint := range stored {
+		if checkpoint != nil {
+			t.Fatalf("transaction %d: expected no checkpoint within the block, got %+v", i, checkpoint)
+		}
+	}
+	if checkpoint := storedCheckpoint(t, path); !reflect.DeepEqual(checkpoint, &Checkpoint{BlockNumber: 6}) {
+		t.Fatalf("expected to resume at block 6, got %+v", checkpoint)
+	}
+}
+
+func TestBlockListenerResumesAfterHandlerFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	listener := newTestListener(t, path)
+
+	var delivered []string
+	failOn := "b"
+	listener.OnTransaction(func(_ uint64, transaction *peer.FilteredTransaction) error {
+		if transaction.GetTxid() == failOn {
+			return errors.New("handler failed")
+		}
+		delivered = append(delivered, transaction.GetTxid())
+		return nil
+	})
+
+	block := filteredBlock(5, "a", "b", "c")
+	if err := listener.processBlock(block, nil); err == nil {
+		t.Fatal("expected the handler failure to stop the block")
+	}
+	if checkpoint := storedCheckpoint(t, path); !reflect.DeepEqual(checkpoint, &Checkpoint{BlockNumber: 5, TransactionID: "a"}) {
+		t.Fatalf("expected a checkpoint after transaction a, got %+v", checkpoint)
+	}
+
+	// A restarted listener replays the block from the stored checkpoint
+	restarted := newTestListener(t, path)
+	restarted.handlers = listener.handlers
+	failOn = ""
+	if err := restarted.processBlock(block, restarted.checkpointer.Checkpoint()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(delivered, want) {
+		t.Fatalf("expected transactions %v to be delivered once, got %v", want, delivered)
+	}
+	if checkpoint := storedCheckpoint(t, path); !reflect.DeepEqual(checkpoint, &Checkpoint{BlockNumber: 6}) {
+		t.Fatalf("expected to resume at block 6, got %+v", checkpoint)
+	}
+}
+
+func TestBlockListenerReplaysUncheckpointedBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	listener := newTestListener(t, path)
+	if err := listener.checkpointer.CheckpointBlock(4); err != nil {
+		t.Fatal(err)
+	}
+
+	var delivered []string
+	listener.OnTransaction(func(_ uint64, transaction *peer.FilteredTransaction) error {
+		delivered = append(delivered, transaction.GetTxid())
+		return nil
+	})
+
+	// Block 5 was interrupted before its checkpoint, so all of its transactions are delivered again
+	if err := listener.processBlock(filteredBlock(5, "a", "b"), listener.checkpointer.Checkpoint()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(delivered, want) {
+		t.Fatalf("expected transactions %v, got %v", want, delivered)
+	}
+}
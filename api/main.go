@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
@@ -8,13 +9,20 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 	"github.com/hyperledger/fabric-gateway/pkg/identity"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Asset represents structure of an asset
@@ -24,30 +32,56 @@ type Asset struct {
 	Size           int    `json:"size"`
 	Owner          string `json:"owner"`
 	AppraisedValue int    `json:"appraisedValue"`
+	OwnerMSP       string `json:"ownerMSP,omitempty"`
+	OwnerIdentity  string `json:"ownerIdentity,omitempty"`
 	CreatedAt      string `json:"createdAt,omitempty"`
 	UpdatedAt      string `json:"updatedAt,omitempty"`
 }
 
-// CreateAssetRequest represents the request to create an asset
+// CreateAssetRequest represents the request to create an asset. The public appraised value is optional;
+// 0 publishes none, and appraisals can be kept private instead.
 type CreateAssetRequest struct {
 	ID             string `json:"ID" binding:"required"`
 	Color          string `json:"color" binding:"required"`
 	Size           int    `json:"size" binding:"required"`
 	Owner          string `json:"owner" binding:"required"`
-	AppraisedValue int    `json:"appraisedValue" binding:"required"`
+	AppraisedValue int    `json:"appraisedValue"`
 }
 
-// UpdateAssetRequest represents the request to update an asset
+// UpdateAssetRequest represents the request to update an asset. The owner changes only through a transfer,
+// and the public appraised value is optional as for CreateAssetRequest.
 type UpdateAssetRequest struct {
 	Color          string `json:"color" binding:"required"`
 	Size           int    `json:"size" binding:"required"`
-	Owner          string `json:"owner" binding:"required"`
-	AppraisedValue int    `json:"appraisedValue" binding:"required"`
+	AppraisedValue int    `json:"appraisedValue"`
 }
 
 // TransferAssetRequest represents the request to transfer an asset
 type TransferAssetRequest struct {
-	NewOwner string `json:"newOwner" binding:"required"`
+	NewOwner         string `json:"newOwner" binding:"required"`
+	NewOwnerMSP      string `json:"newOwnerMSP" binding:"required"`
+	NewOwnerIdentity string `json:"newOwnerIdentity" binding:"required"`
+}
+
+// QueryAssetsRequest represents a CouchDB rich query, optionally paginated
+type QueryAssetsRequest struct {
+	Query    json.RawMessage `json:"query" binding:"required"`
+	PageSize int32           `json:"pageSize"`
+	Bookmark string          `json:"bookmark"`
+}
+
+// AppraisalRequest represents a private appraisal of an asset.
+// It is passed to the chaincode in the transient map, never as a transaction argument.
+type AppraisalRequest struct {
+	AppraisedValue int    `json:"appraisedValue" binding:"required"`
+	Salt           string `json:"salt" binding:"required"`
+}
+
+// AssetAppraisal represents the private appraisal of an asset as stored in an org's collection
+type AssetAppraisal struct {
+	AssetID        string `json:"assetId"`
+	AppraisedValue int    `json:"appraisedValue"`
+	Salt           string `json:"salt"`
 }
 
 // AssetHistory represents the history of an asset
@@ -59,162 +93,248 @@ type AssetHistory struct {
 	Timestamp string `json:"timestamp"`
 }
 
+// LedgerHistoryEntry represents one committed version of an asset from the ledger history
+type LedgerHistoryEntry struct {
+	TxID      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+	IsDelete  bool   `json:"isDelete"`
+	Value     *Asset `json:"value,omitempty"`
+}
+
+// PaginatedAssets represents a page of assets with the bookmark of the next page
+type PaginatedAssets struct {
+	Records      []Asset `json:"records"`
+	FetchedCount int32   `json:"fetchedCount"`
+	Bookmark     string  `json:"bookmark"`
+}
+
+// PaginatedHistory represents a page of history records with the bookmark of the next page
+type PaginatedHistory struct {
+	Records      []AssetHistory `json:"records"`
+	FetchedCount int32          `json:"fetchedCount"`
+	Bookmark     string         `json:"bookmark"`
+}
+
 // OrgSetup contains organization's config to interact with the network
 type OrgSetup struct {
-	OrgName      string
-	MSPID        string
-	CertPath     string
-	KeyPath      string
-	TLSCertPath  string
-	PeerEndpoint string
-	GatewayPeer  string
-	Gateway      client.Gateway
+	OrgName       string
+	UserName      string
+	MSPID         string
+	CertPath      string
+	KeyPath       string
+	APIKey        string
+	Peers         []PeerEndpoint
+	ChannelName   string
+	ChaincodeName string
+	Gateway       client.Gateway
 }
 
 var (
-	orgSetup OrgSetup
+	gateways *GatewayRegistry
 )
 
-// initializeGateway initializes the Fabric Gateway connection
-func initializeGateway() error {
-	// Set up the organization configuration based on test-network structure
-	cryptoPath := "/home/myindo/workspace/myindo/hyperledger-go/fabric-samples/test-network/organizations/peerOrganizations/org1.example.com"
+// defaultPageSize is used when a bookmark is given without a pageSize
+const defaultPageSize = 100
 
-	orgSetup = OrgSetup{
-		OrgName:      "Org1",
-		MSPID:        "Org1MSP",
-		CertPath:     cryptoPath + "/users/Admin@org1.example.com/msp/signcerts/Admin@org1.example.com-cert.pem",
-		KeyPath:      cryptoPath + "/users/Admin@org1.example.com/msp/keystore/",
-		TLSCertPath:  cryptoPath + "/peers/peer0.org1.example.com/tls/ca.crt",
-		PeerEndpoint: "localhost:7051",
-		GatewayPeer:  "peer0.org1.example.com",
+// initializeGateways connects a gateway for every organization identity described by the configuration.
+// The configured identities are loaded into the wallet, where identities enrolled later are kept too.
+func initializeGateways(cfg *Config, wallet Wallet) error {
+	setups, err := cfg.OrgSetups()
+	if err != nil {
+		return err
 	}
 
-	log.Printf("Initializing connection for %s...", orgSetup.OrgName)
+	gateways = NewGatewayRegistry(cfg.Client.Organization, wallet, cfg.Connection)
+	for _, setup := range setups {
+		log.Printf("Initializing connection for %s as %s...", setup.OrgName, setup.UserName)
+		if err := gateways.AddOrg(setup); err != nil {
+			gateways.Close()
+			return err
+		}
 
-	clientConnection := orgSetup.newGrpcConnection()
-	id := orgSetup.newIdentity()
-	sign := orgSetup.newSign()
+		id, err := loadMSPIdentity(setup.MSPID, setup.CertPath, setup.KeyPath)
+		if err != nil {
+			gateways.Close()
+			return fmt.Errorf("failed to load identity %s of %s: %v", setup.UserName, setup.OrgName, err)
+		}
+		if err := wallet.Put(walletLabel(setup.OrgName, setup.UserName), id); err != nil {
+			gateways.Close()
+			return fmt.Errorf("failed to store identity %s of %s in the wallet: %v", setup.UserName, setup.OrgName, err)
+		}
+		gateways.SetAPIKey(setup.OrgName, setup.UserName, setup.APIKey)
 
-	gateway, err := client.Connect(
-		id,
-		client.WithSign(sign),
-		client.WithClientConnection(clientConnection),
-		// Default timeouts are sufficient for most operations
-	)
-	if err != nil {
-		return fmt.Errorf("failed to connect to gateway: %v", err)
+		if _, err := gateways.Lookup(setup.OrgName, setup.UserName); err != nil {
+			gateways.Close()
+			return err
+		}
 	}
-	orgSetup.Gateway = *gateway
 
 	log.Println("Gateway initialization complete")
 	return nil
 }
 
-// newGrpcConnection creates a gRPC connection to the Gateway server
-func (setup OrgSetup) newGrpcConnection() *grpc.ClientConn {
-	certificate, err := loadCertificate(setup.TLSCertPath)
+// loadCertificate reads a PEM certificate file
+func loadCertificate(filename string) (*x509.Certificate, error) {
+	certificatePEM, err := ioutil.ReadFile(filename)
 	if err != nil {
-		log.Panicf("failed to load TLS certificate: %v", err)
+		return nil, fmt.Errorf("failed to read certificate file: %w", err)
 	}
+	return identity.CertificateFromPEM(certificatePEM)
+}
 
-	certPool := x509.NewCertPool()
-	certPool.AddCert(certificate)
-	transportCredentials := credentials.NewClientTLSFromCert(certPool, setup.GatewayPeer)
+// evaluateTransaction evaluates a transaction (query)
+func (setup *OrgSetup) evaluateTransaction(ctx context.Context, function string, args ...string) ([]byte, error) {
+	return setup.evaluateTransactionWithOptions(ctx, function, client.WithArguments(args...))
+}
+
+// evaluateTransactionWithTransient evaluates a transaction (query) that reads private data passed in the transient map
+func (setup *OrgSetup) evaluateTransactionWithTransient(ctx context.Context, function string, transient map[string][]byte, args ...string) ([]byte, error) {
+	return setup.evaluateTransactionWithOptions(ctx, function, client.WithArguments(args...), client.WithTransient(traceTransient(ctx, transient)))
+}
 
-	connection, err := grpc.Dial(setup.PeerEndpoint, grpc.WithTransportCredentials(transportCredentials))
+// evaluateTransactionWithOptions evaluates a transaction built from the given proposal options,
+// within the evaluate timeout of the request's route
+func (setup *OrgSetup) evaluateTransactionWithOptions(ctx context.Context, function string, options ...client.ProposalOption) ([]byte, error) {
+	network := setup.Gateway.GetNetwork(setup.ChannelName)
+	contract := network.GetContract(setup.ChaincodeName)
+
+	txn_proposal, err := contract.NewProposal(function, withTraceContext(ctx, options...)...)
 	if err != nil {
-		log.Panicf("failed to create gRPC connection: %v", err)
+		return nil, fmt.Errorf("failed to create transaction proposal: %w", err)
 	}
 
-	return connection
+	evaluateCtx, cancel := context.WithTimeout(ctx, timeoutsFromContext(ctx).Evaluate)
+	defer cancel()
+
+	evaluateCtx, end := setup.startGatewayCall(evaluateCtx, "evaluate", function, txn_proposal.TransactionID())
+	result, err := txn_proposal.EvaluateWithContext(evaluateCtx)
+	end(err)
+	return result, err
 }
 
-// newIdentity creates a client identity for this Gateway connection using an X.509 certificate
-func (setup OrgSetup) newIdentity() *identity.X509Identity {
-	certificate, err := loadCertificate(setup.CertPath)
-	if err != nil {
-		log.Panicf("failed to load certificate: %v", err)
-	}
+// submitAsync endorses a transaction and submits it to the orderer without waiting for it to commit
+func (setup *OrgSetup) submitAsync(ctx context.Context, function string, options ...client.ProposalOption) ([]byte, *client.Commit, error) {
+	network := setup.Gateway.GetNetwork(setup.ChannelName)
+	contract := network.GetContract(setup.ChaincodeName)
+	timeouts := timeoutsFromContext(ctx)
 
-	id, err := identity.NewX509Identity(setup.MSPID, certificate)
+	txn_proposal, err := contract.NewProposal(function, withTraceContext(ctx, options...)...)
 	if err != nil {
-		log.Panicf("failed to create identity: %v", err)
+		return nil, nil, fmt.Errorf("failed to create transaction proposal: %w", err)
 	}
+	txID := txn_proposal.TransactionID()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String(transactionIDAttribute, txID))
 
-	return id
-}
-
-// newSign creates a function that generates a digital signature from a message digest using a private key
-func (setup OrgSetup) newSign() identity.Sign {
-	files, err := ioutil.ReadDir(setup.KeyPath)
+	endorseCtx, cancel := context.WithTimeout(ctx, timeouts.Endorse)
+	defer cancel()
+	endorseCtx, end := setup.startGatewayCall(endorseCtx, "endorse", function, txID)
+	txn_endorsed, err := txn_proposal.EndorseWithContext(endorseCtx)
+	end(err)
 	if err != nil {
-		log.Panicf("failed to read private key directory: %v", err)
+		return nil, nil, fmt.Errorf("failed to endorse transaction: %w", err)
 	}
 
-	privateKeyPEM, err := ioutil.ReadFile(path.Join(setup.KeyPath, files[0].Name()))
+	submitCtx, cancel := context.WithTimeout(ctx, timeouts.Submit)
+	defer cancel()
+	submitCtx, end = setup.startGatewayCall(submitCtx, "submit", function, txID)
+	txn_committed, err := txn_endorsed.SubmitWithContext(submitCtx)
+	end(err)
 	if err != nil {
-		log.Panicf("failed to read private key file: %v", err)
+		return nil, nil, fmt.Errorf("failed to submit transaction: %w", err)
 	}
 
-	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+	return txn_endorsed.Result(), txn_committed, nil
+}
+
+// submitAndWait endorses and submits a transaction and waits for it to commit
+func (setup *OrgSetup) submitAndWait(ctx context.Context, function string, options ...client.ProposalOption) ([]byte, error) {
+	result, commit, err := setup.submitAsync(ctx, function, options...)
 	if err != nil {
-		log.Panicf("failed to parse private key: %v", err)
+		return nil, err
 	}
 
-	sign, err := identity.NewPrivateKeySign(privateKey)
+	statusCtx, cancel := context.WithTimeout(ctx, timeoutsFromContext(ctx).CommitStatus)
+	defer cancel()
+	status, err := setup.commitStatus(statusCtx, function, commit)
 	if err != nil {
-		log.Panicf("failed to create sign function: %v", err)
+		return nil, fmt.Errorf("failed to get commit status: %w", err)
+	}
+	if !status.Successful {
+		return nil, &CommitFailedError{TransactionID: status.TransactionID, Code: status.Code}
 	}
 
-	return sign
+	return result, nil
 }
 
-func loadCertificate(filename string) (*x509.Certificate, error) {
-	certificatePEM, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read certificate file: %w", err)
+// commitStatus waits for the commit status of a transaction submitted for the chaincode function
+func (setup *OrgSetup) commitStatus(ctx context.Context, function string, commit *client.Commit) (*client.Status, error) {
+	ctx, end := setup.startGatewayCall(ctx, "commit_status", function, commit.TransactionID())
+	status, err := commit.StatusWithContext(ctx)
+	if err == nil {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String(validationCodeAttribute, status.Code.String()))
 	}
-	return identity.CertificateFromPEM(certificatePEM)
+	end(err)
+	return status, err
 }
 
-// evaluateTransaction evaluates a transaction (query)
-func evaluateTransaction(function string, args ...string) ([]byte, error) {
-	network := orgSetup.Gateway.GetNetwork("mychannel")
-	contract := network.GetContract("basic")
+// submitTransactionWithOptions endorses and submits a transaction built from the given proposal options,
+// and waits for it to commit. A transaction invalidated by a read conflict is endorsed and submitted again,
+// as a new transaction, as allowed by the retry policy. retries reports how often that happened.
+func (setup *OrgSetup) submitTransactionWithOptions(ctx context.Context, function string, options ...client.ProposalOption) (result []byte, retries int, err error) {
+	ctx, span := tracer.Start(ctx, "submitTransaction "+function, trace.WithAttributes(setup.transactionAttributes(function)...))
+	defer func() {
+		span.SetAttributes(attribute.Int(retriesAttribute, retries))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
 
-	return contract.EvaluateTransaction(function, args...)
+	return retryPolicy.retry(ctx, function, func() ([]byte, error) {
+		return setup.submitAndWait(ctx, function, options...)
+	})
 }
 
-// submitTransaction submits a transaction (invoke)
-func submitTransaction(function string, args ...string) ([]byte, error) {
-	network := orgSetup.Gateway.GetNetwork("mychannel")
-	contract := network.GetContract("basic")
+// paginationParams reads the pageSize and bookmark query parameters.
+// paginated is false when neither parameter is present, in which case the unpaginated query is used.
+func paginationParams(c *gin.Context) (pageSize string, bookmark string, paginated bool, err error) {
+	pageSize, hasPageSize := c.GetQuery("pageSize")
+	bookmark, hasBookmark := c.GetQuery("bookmark")
+	if !hasPageSize && !hasBookmark {
+		return "", "", false, nil
+	}
 
-	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create transaction proposal: %v", err)
+	if !hasPageSize {
+		pageSize = fmt.Sprintf("%d", defaultPageSize)
 	}
+	size, err := strconv.ParseInt(pageSize, 10, 32)
+	if err != nil || size <= 0 {
+		return "", "", false, fmt.Errorf("pageSize must be a positive integer")
+	}
+
+	return pageSize, bookmark, true, nil
+}
 
-	txn_endorsed, err := txn_proposal.Endorse()
+// respondWithPage writes the result of a paginated query, decoded into page
+func respondWithPage(c *gin.Context, output []byte, err error, page interface{}) {
 	if err != nil {
-		return nil, fmt.Errorf("failed to endorse transaction: %v", err)
+		respondWithError(c, err)
+		return
 	}
 
-	_, err = txn_endorsed.Submit()
+	err = json.Unmarshal(output, page)
 	if err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+		respondWithError(c, err)
+		return
 	}
 
-	result := txn_endorsed.Result()
-	return result, nil
+	c.JSON(http.StatusOK, page)
 }
 
 // initLedger initializes ledger with sample data
 func initLedger(c *gin.Context) {
-	_, err := submitTransaction("InitLedger")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !submitRequestTransaction(c, "InitLedger") {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Ledger initialized successfully"})
@@ -228,9 +348,7 @@ func createAsset(c *gin.Context) {
 		return
 	}
 
-	_, err := submitTransaction("CreateAsset", req.ID, req.Color, fmt.Sprintf("%d", req.Size), req.Owner, fmt.Sprintf("%d", req.AppraisedValue))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !submitRequestTransaction(c, "CreateAsset", client.WithArguments(req.ID, req.Color, fmt.Sprintf("%d", req.Size), req.Owner, fmt.Sprintf("%d", req.AppraisedValue))) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Asset created successfully", "id": req.ID})
@@ -239,16 +357,16 @@ func createAsset(c *gin.Context) {
 // readAsset reads an asset by ID
 func readAsset(c *gin.Context) {
 	id := c.Param("id")
-	output, err := evaluateTransaction("ReadAsset", id)
+	output, err := requestGateway(c).evaluateTransaction(c.Request.Context(), "ReadAsset", id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 
 	var asset Asset
 	err = json.Unmarshal(output, &asset)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 
@@ -264,9 +382,7 @@ func updateAsset(c *gin.Context) {
 		return
 	}
 
-	_, err := submitTransaction("UpdateAsset", id, req.Color, fmt.Sprintf("%d", req.Size), req.Owner, fmt.Sprintf("%d", req.AppraisedValue))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !submitRequestTransaction(c, "UpdateAsset", client.WithArguments(id, req.Color, fmt.Sprintf("%d", req.Size), fmt.Sprintf("%d", req.AppraisedValue))) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Asset updated successfully"})
@@ -275,9 +391,7 @@ func updateAsset(c *gin.Context) {
 // deleteAsset deletes an asset by ID
 func deleteAsset(c *gin.Context) {
 	id := c.Param("id")
-	_, err := submitTransaction("DeleteAsset", id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !submitRequestTransaction(c, "DeleteAsset", client.WithArguments(id)) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Asset deleted successfully"})
@@ -292,64 +406,242 @@ func transferAsset(c *gin.Context) {
 		return
 	}
 
-	_, err := submitTransaction("TransferAsset", id, req.NewOwner)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !submitRequestTransaction(c, "TransferAsset", client.WithArguments(id, req.NewOwner, req.NewOwnerMSP, req.NewOwnerIdentity)) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Asset transferred successfully"})
 }
 
-// getAllAssets retrieves all assets
+// appraisalTransient encodes the appraisal in the request body as the transient map expected by the chaincode
+func appraisalTransient(c *gin.Context) (map[string][]byte, error) {
+	var req AppraisalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+
+	appraisalJSON, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string][]byte{"asset_appraisal": appraisalJSON}, nil
+}
+
+// setAssetAppraisal stores the appraisal of an asset in the owning org's private collection
+func setAssetAppraisal(c *gin.Context) {
+	id := c.Param("id")
+	transient, err := appraisalTransient(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Transient data is sent to the endorsing peers but never written to the ledger. Only peers of the
+	// submitting org, which the chaincode requires to own the asset, may receive the appraisal.
+	if !submitRequestTransaction(c, "SetAssetAppraisal", client.WithArguments(id), client.WithTransient(traceTransient(c.Request.Context(), transient)),
+		client.WithEndorsingOrganizations(requestGateway(c).MSPID)) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Asset appraisal stored successfully"})
+}
+
+// readAssetAppraisal reads the appraisal of an asset from this org's private collection
+func readAssetAppraisal(c *gin.Context) {
+	id := c.Param("id")
+	output, err := requestGateway(c).evaluateTransaction(c.Request.Context(), "ReadAssetAppraisal", id)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	var appraisal AssetAppraisal
+	err = json.Unmarshal(output, &appraisal)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, appraisal)
+}
+
+// verifyAssetAppraisal checks a claimed appraisal against the hash of the stored private appraisal
+func verifyAssetAppraisal(c *gin.Context) {
+	id := c.Param("id")
+	transient, err := appraisalTransient(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	output, err := requestGateway(c).evaluateTransactionWithTransient(c.Request.Context(), "VerifyAppraisal", transient, id)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	var verified bool
+	err = json.Unmarshal(output, &verified)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"verified": verified})
+}
+
+// getAllAssets retrieves all assets, or a single page of them when pagination parameters are given.
+// Once the off-chain index has caught up with the current ledger height it serves the request, with filtering
+// and sorting, unless source=ledger asks for a chaincode query.
 func getAllAssets(c *gin.Context) {
-	output, err := evaluateTransaction("GetAllAssets")
+	pageSize, bookmark, paginated, err := paginationParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if paginated {
+		output, err := requestGateway(c).evaluateTransaction(c.Request.Context(), "GetAllAssetsWithPagination", pageSize, bookmark)
+		respondWithPage(c, output, err, &PaginatedAssets{})
+		return
+	}
+
+	if c.Query("source") != "ledger" {
+		if assetIndexer != nil && assetIndexer.CaughtUp() {
+			listIndexedAssets(c)
+			return
+		}
+		if hasAssetFilter(c) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "filtering requires the asset index, which is not available yet"})
+			return
+		}
+	}
+
+	output, err := requestGateway(c).evaluateTransaction(c.Request.Context(), "GetAllAssets")
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	var assets []Asset
+	err = json.Unmarshal(output, &assets)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, assets)
+}
+
+// queryAssets runs a CouchDB rich query against the asset state
+func queryAssets(c *gin.Context) {
+	var req QueryAssetsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.PageSize < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pageSize must be a positive integer"})
+		return
+	}
+	if req.PageSize > 0 || req.Bookmark != "" {
+		pageSize := req.PageSize
+		if pageSize == 0 {
+			pageSize = defaultPageSize
+		}
+		output, err := requestGateway(c).evaluateTransaction(c.Request.Context(), "QueryAssetsWithPagination", string(req.Query), fmt.Sprintf("%d", pageSize), req.Bookmark)
+		respondWithPage(c, output, err, &PaginatedAssets{})
+		return
+	}
+
+	output, err := requestGateway(c).evaluateTransaction(c.Request.Context(), "QueryAssets", string(req.Query))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 
 	var assets []Asset
 	err = json.Unmarshal(output, &assets)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, assets)
 }
 
-// getAssetsByOwner retrieves assets by owner
+// getAssetsByOwner retrieves assets by owner, or a single page of them when pagination parameters are given
 func getAssetsByOwner(c *gin.Context) {
 	owner := c.Param("owner")
-	output, err := evaluateTransaction("GetAssetsByOwner", owner)
+	pageSize, bookmark, paginated, err := paginationParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if paginated {
+		output, err := requestGateway(c).evaluateTransaction(c.Request.Context(), "GetAssetsByOwnerWithPagination", owner, pageSize, bookmark)
+		respondWithPage(c, output, err, &PaginatedAssets{})
+		return
+	}
+
+	output, err := requestGateway(c).evaluateTransaction(c.Request.Context(), "GetAssetsByOwner", owner)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 
 	var assets []Asset
 	err = json.Unmarshal(output, &assets)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, assets)
 }
 
-// getAssetHistory retrieves the history of an asset
+// getAssetHistory retrieves the history of an asset, or a single page of it when pagination parameters are given
 func getAssetHistory(c *gin.Context) {
 	assetID := c.Param("id")
-	output, err := evaluateTransaction("GetAssetHistory", assetID)
+	pageSize, bookmark, paginated, err := paginationParams(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if paginated {
+		output, err := requestGateway(c).evaluateTransaction(c.Request.Context(), "GetAssetHistoryWithPagination", assetID, pageSize, bookmark)
+		respondWithPage(c, output, err, &PaginatedHistory{})
+		return
+	}
+
+	output, err := requestGateway(c).evaluateTransaction(c.Request.Context(), "GetAssetHistory", assetID)
+	if err != nil {
+		respondWithError(c, err)
 		return
 	}
 
 	var history []AssetHistory
 	err = json.Unmarshal(output, &history)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// getAssetLedgerHistory retrieves every committed version of an asset from the ledger
+func getAssetLedgerHistory(c *gin.Context) {
+	assetID := c.Param("id")
+	output, err := requestGateway(c).evaluateTransaction(c.Request.Context(), "GetAssetLedgerHistory", assetID)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	var history []LedgerHistoryEntry
+	err = json.Unmarshal(output, &history)
+	if err != nil {
+		respondWithError(c, err)
 		return
 	}
 
@@ -358,82 +650,238 @@ func getAssetHistory(c *gin.Context) {
 
 // getAssetCount retrieves the total count of assets
 func getAssetCount(c *gin.Context) {
-	output, err := evaluateTransaction("GetAssetCount")
+	output, err := requestGateway(c).evaluateTransaction(c.Request.Context(), "GetAssetCount")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 
 	var count int
 	err = json.Unmarshal(output, &count)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"count": count})
 }
 
+// registerRoutes registers the asset API routes on the group
+func registerRoutes(api *gin.RouterGroup) {
+	// Ledger operations
+	api.POST("/ledger/init", initLedger)
+
+	// Asset operations
+	api.POST("/assets", createAsset)
+	api.GET("/assets", getAllAssets)
+	api.GET("/assets/count", getAssetCount)
+	api.POST("/assets/query", queryAssets)
+	api.GET("/assets/:id", readAsset)
+	api.GET("/assets/:id/history", getAssetHistory)
+	api.GET("/assets/:id/ledger-history", getAssetLedgerHistory)
+	api.PUT("/assets/:id", updateAsset)
+	api.DELETE("/assets/:id", deleteAsset)
+	api.POST("/assets/:id/transfer", transferAsset)
+
+	// Private appraisal operations
+	api.PUT("/assets/:id/appraisal", setAssetAppraisal)
+	api.GET("/assets/:id/appraisal", readAssetAppraisal)
+	api.POST("/assets/:id/appraisal/verify", verifyAssetAppraisal)
+
+	// Commit status of transactions submitted with ?async=true
+	api.GET("/transactions/:txId/status", getTransactionStatus)
+
+	// Off-chain index
+	api.GET("/indexer/status", getIndexerStatus)
+
+	// Chaincode event streams
+	api.GET("/events/stream", streamEventsSSE)
+	api.GET("/events/ws", streamEventsWebSocket)
+
+	// Owner-specific operations
+	api.GET("/owners/:owner/assets", getAssetsByOwner)
+
+	// Identity management, restricted to the organization's Admin
+	admin := api.Group("/admin", requireOrgAdmin)
+	admin.POST("/users", registerUser)
+	admin.POST("/users/:enrollmentId/enroll", enrollUser)
+	admin.GET("/identities", listIdentities)
+	admin.DELETE("/identities/:user", removeIdentity)
+}
+
+// registerOfflineRoutes registers the offline-signing routes on the group, whose requests act for the
+// organization selectOrganization picks rather than for a wallet identity
+func registerOfflineRoutes(offline *gin.RouterGroup) {
+	offline.POST("/proposals", createOfflineProposal)
+	offline.POST("/endorse", endorseOfflineProposal)
+	offline.POST("/submit", submitOfflineTransaction)
+	offline.POST("/commit-status", getOfflineCommitStatus)
+}
+
 func main() {
-	// Initialize Fabric Gateway
-	err := initializeGateway()
+	// Load configuration
+	cfg, err := LoadConfig(configFilePath())
 	if err != nil {
-		log.Fatalf("Failed to initialize Fabric Gateway: %v", err)
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
-	defer orgSetup.Gateway.Close()
 
-	// Initialize Gin router
-	r := gin.Default()
+	// Export traces as configured; flushed after everything else has stopped
+	shutdownTracing, err := initTracing(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}()
+
+	// Open the wallet holding the identities requests transact as
+	var wallet Wallet = NewInMemoryWallet()
+	if cfg.Wallet.Type == "filesystem" {
+		wallet, err = NewFileSystemWallet(cfg.Wallet.Path)
+		if err != nil {
+			log.Fatalf("Failed to open wallet: %v", err)
+		}
+	}
 
-	// CORS middleware
-	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	// Initialize a Fabric Gateway for every configured organization identity
+	err = initializeGateways(cfg, wallet)
+	if err != nil {
+		log.Fatalf("Failed to initialize Fabric Gateway: %v", err)
+	}
+	defer gateways.Close()
+	defaultGateway := gateways.Default()
+	retryPolicy = cfg.Retry
+	callTimeouts = cfg.Timeouts
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+	for orgName, org := range cfg.Organizations {
+		if org.CA == nil {
+			continue
+		}
+		ca, err := NewCAClient(*org.CA)
+		if err != nil {
+			log.Fatalf("Failed to set up certificate authority of %s: %v", orgName, err)
 		}
+		certificateAuthorities[orgName] = ca
+	}
 
-		c.Next()
-	})
+	// Start the checkpointed block listener
+	checkpointer, err := NewFileCheckpointer(cfg.Storage.CheckpointFile)
+	if err != nil {
+		log.Fatalf("Failed to load block checkpoint: %v", err)
+	}
+	listenerCtx, stopListener := context.WithCancel(context.Background())
+	defer stopListener()
+	var background sync.WaitGroup
+
+	// The listener and the indexer share one poller of the channel height to report their lag
+	network := defaultGateway.Gateway.GetNetwork(defaultGateway.ChannelName)
+	heights := NewLedgerHeightPoller(network, defaultGateway.ChannelName)
+
+	listener := NewBlockListener(network, checkpointer, heights)
+	listener.OnTransaction(logTransaction)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		listener.Run(listenerCtx)
+	}()
+
+	// Start the off-chain asset indexer
+	indexerDB := cfg.Storage.IndexerDB
+	if err := os.MkdirAll(path.Dir(indexerDB), 0o755); err != nil {
+		log.Fatalf("Failed to create indexer directory: %v", err)
+	}
+	assetIndexer, err = NewIndexer(indexerDB, network, heights, defaultGateway.ChannelName, defaultGateway.ChaincodeName)
+	if err != nil {
+		log.Fatalf("Failed to open asset index: %v", err)
+	}
+	defer assetIndexer.Close()
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		assetIndexer.Run(listenerCtx)
+	}()
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		heights.Run(listenerCtx)
+	}()
+
+	// Require a valid JWT on every API request unless authentication is disabled
+	if cfg.Auth.Disabled {
+		log.Println("WARNING: authentication is disabled; every request can act as any configured identity")
+	} else {
+		authenticator, err = NewAuthenticator(cfg.Auth)
+		if err != nil {
+			log.Fatalf("Failed to set up authentication: %v", err)
+		}
+	}
 
-	// API routes
-	api := r.Group("/api/v1")
-	{
-		// Ledger operations
-		api.POST("/ledger/init", initLedger)
-
-		// Asset operations
-		api.POST("/assets", createAsset)
-		api.GET("/assets", getAllAssets)
-		api.GET("/assets/count", getAssetCount)
-		api.GET("/assets/:id", readAsset)
-		api.GET("/assets/:id/history", getAssetHistory)
-		api.PUT("/assets/:id", updateAsset)
-		api.DELETE("/assets/:id", deleteAsset)
-		api.POST("/assets/:id/transfer", transferAsset)
-
-		// Owner-specific operations
-		api.GET("/owners/:owner/assets", getAssetsByOwner)
-	}
-
-	// Health check
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "healthy",
-			"service": "fabric-api",
-			"sdk":     "fabric-gateway",
-		})
-	})
+	// Initialize Gin router; the request log redacts the access_token of event stream URLs
+	r := gin.New()
+	r.Use(gin.LoggerWithFormatter(redactedLogFormatter), gin.Recovery())
+
+	// Only the configured browser origins may call the API cross-origin
+	allowedOrigins = cfg.Server.AllowedOrigins
+	r.Use(corsMiddleware())
+
+	// Count and time every request for /metrics
+	r.Use(observeRequests)
+
+	// Trace every request; the gateway calls made for it become child spans
+	r.Use(traceRequests)
+
+	// API routes, acting as the identity selectGateway picks for each request
+	api := r.Group("/api/v1", selectGateway, applyCallTimeouts)
+	registerRoutes(api)
+	registerRoutes(r.Group("/api/v1/orgs/:org", selectGateway, applyCallTimeouts))
+
+	// Offline signing for clients that hold their own private key
+	registerOfflineRoutes(r.Group("/api/v1/offline", selectOrganization, applyCallTimeouts))
+	registerOfflineRoutes(r.Group("/api/v1/orgs/:org/offline", selectOrganization, applyCallTimeouts))
+
+	// Liveness and readiness probes; /readyz checks the peers and the chaincode. /health, which the
+	// setup scripts call, is kept as an alias of /livez.
+	r.GET("/livez", livez)
+	r.GET("/health", livez)
+	r.GET("/readyz", readyz)
+
+	// Prometheus metrics
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	port := ":" + cfg.Server.Port
+	server := &http.Server{Addr: port, Handler: r}
+	server.RegisterOnShutdown(stopStreams)
+
+	shutdown, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Starting Fabric Gateway-based API server on port %s", port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		log.Printf("Server failed: %v", err)
+	case <-shutdown.Done():
+		stopSignals()
+		log.Printf("Shutting down; waiting up to %s for in-flight requests", cfg.Server.ShutdownTimeout)
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Failed to drain in-flight requests: %v", err)
+		}
 	}
-	port = ":" + port
-	log.Printf("Starting Fabric Gateway-based API server on port %s", port)
-	log.Fatal(r.Run(port))
+
+	// Stop the block consumers before the index and gateway connections are closed by the deferred calls
+	stopListener()
+	background.Wait()
+	log.Println("Server stopped")
 }
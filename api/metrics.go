@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// latencyBuckets extend the default buckets to cover commit waits of up to a minute
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// Prometheus metrics, served on /metrics
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fabric_api_http_requests_total",
+		Help: "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fabric_api_http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route.",
+		Buckets: latencyBuckets,
+	}, []string{"method", "route"})
+
+	gatewayCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fabric_api_gateway_call_duration_seconds",
+		Help:    "Latency of evaluate, endorse, submit and commit_status gateway calls by chaincode function and outcome.",
+		Buckets: latencyBuckets,
+	}, []string{"call", "chaincode", "function", "outcome"})
+
+	committedTransactions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fabric_api_committed_transactions_total",
+		Help: "Transactions committed on the channel, as seen by the block listener, by validation code.",
+	}, []string{"channel", "validation_code"})
+
+	retryCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fabric_api_transaction_retries_total",
+		Help: "Transactions endorsed and submitted again after a read conflict, by chaincode function and validation code.",
+	}, []string{"function", "validation_code"})
+
+	retriesExhaustedCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fabric_api_transaction_retries_exhausted_total",
+		Help: "Transactions that still failed with a read conflict after the last attempt, by chaincode function.",
+	}, []string{"function"})
+
+	listenerBlockLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fabric_api_block_listener_lag_blocks",
+		Help: "Blocks committed on the channel that the block listener has not processed yet.",
+	}, []string{"channel"})
+)
+
+func init() {
+	prometheus.MustRegister(httpRequests, httpRequestDuration, gatewayCallDuration, committedTransactions,
+		retryCount, retriesExhaustedCount, listenerBlockLag)
+}
+
+// observeRequests records the count and latency of every request by its route pattern, so paths with
+// asset IDs do not create a series each. Requests that match no route are recorded as "unmatched".
+func observeRequests(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+	httpRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+}
+
+// observeGatewayCall records the latency of a gateway call made for a chaincode function since start
+func observeGatewayCall(call, chaincode, function string, start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	gatewayCallDuration.WithLabelValues(call, chaincode, function, outcome).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// readMetric returns the current state of a counter, gauge or histogram series
+func readMetric(t *testing.T, metric prometheus.Metric) *dto.Metric {
+	t.Helper()
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return &m
+}
+
+// counterValue returns the value of the counter
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	t.Helper()
+	return readMetric(t, counter).GetCounter().GetValue()
+}
+
+// gaugeValue returns the value of the gauge
+func gaugeValue(t *testing.T, gauge prometheus.Gauge) float64 {
+	t.Helper()
+	return readMetric(t, gauge).GetGauge().GetValue()
+}
+
+// sampleCount returns how many observations the histogram has recorded
+func sampleCount(t *testing.T, histogram prometheus.Observer) uint64 {
+	t.Helper()
+	return readMetric(t, histogram.(prometheus.Metric)).GetHistogram().GetSampleCount()
+}
+
+func TestObserveRequestsLabelsRoutePattern(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(observeRequests)
+	router.GET("/api/v1/assets/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	matched := httpRequests.WithLabelValues(http.MethodGet, "/api/v1/assets/:id", "200")
+	unmatched := httpRequests.WithLabelValues(http.MethodGet, "unmatched", "404")
+	duration := httpRequestDuration.WithLabelValues(http.MethodGet, "/api/v1/assets/:id")
+	matchedBefore, unmatchedBefore := counterValue(t, matched), counterValue(t, unmatched)
+	durationBefore := sampleCount(t, duration)
+
+	for _, path := range []string{"/api/v1/assets/asset1", "/api/v1/assets/asset2", "/api/v1/unknown"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := counterValue(t, matched) - matchedBefore; got != 2 {
+		t.Errorf("expected 2 requests recorded under the route pattern, got %v", got)
+	}
+	if got := counterValue(t, unmatched) - unmatchedBefore; got != 1 {
+		t.Errorf("expected 1 unmatched request, got %v", got)
+	}
+	if got := sampleCount(t, duration) - durationBefore; got != 2 {
+		t.Errorf("expected 2 latency observations, got %d", got)
+	}
+}
+
+func TestObserveGatewayCallRecordsOutcome(t *testing.T) {
+	success := gatewayCallDuration.WithLabelValues("evaluate", "basic", "ReadAsset", "success")
+	failure := gatewayCallDuration.WithLabelValues("evaluate", "basic", "ReadAsset", "error")
+	successBefore, failureBefore := sampleCount(t, success), sampleCount(t, failure)
+
+	observeGatewayCall("evaluate", "basic", "ReadAsset", time.Now(), nil)
+	observeGatewayCall("evaluate", "basic", "ReadAsset", time.Now(), errors.New("asset not found"))
+	observeGatewayCall("evaluate", "basic", "ReadAsset", time.Now(), nil)
+
+	if got := sampleCount(t, success) - successBefore; got != 2 {
+		t.Errorf("expected 2 successful calls, got %d", got)
+	}
+	if got := sampleCount(t, failure) - failureBefore; got != 1 {
+		t.Errorf("expected 1 failed call, got %d", got)
+	}
+}
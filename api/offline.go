@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	gatewaypb "github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// The offline-signing flow lets clients that keep their own private key transact through the API.
+// Each step returns a message and its digest; the client signs the digest (ECDSA, DER-encoded,
+// without hashing it again) and posts the message and signature to the next step. All binary values
+// are base64-encoded. The API never sees the private key and keeps no state between steps.
+// The requests transact with the organization selectOrganization picks, as the identity that signed
+// the message, which must belong to the organization and, when the request claims a user, be issued to it.
+
+// OfflineProposalRequest represents the request body for creating an unsigned transaction proposal
+type OfflineProposalRequest struct {
+	Function    string   `json:"function" binding:"required"`
+	Args        []string `json:"args"`
+	Certificate string   `json:"certificate" binding:"required"`
+}
+
+// OfflineSignedRequest represents the request body carrying a message and the client's signature of its digest
+type OfflineSignedRequest struct {
+	Message   string `json:"message" binding:"required"`
+	Signature string `json:"signature" binding:"required"`
+}
+
+// OfflineMessage represents a message for the client to sign, with the digest to sign
+type OfflineMessage struct {
+	TransactionID string `json:"transactionId"`
+	Message       string `json:"message"`
+	Digest        string `json:"digest"`
+	Result        string `json:"result,omitempty"`
+}
+
+// OfflineCommitStatus represents the commit status of a transaction submitted through the offline flow
+type OfflineCommitStatus struct {
+	TransactionID  string `json:"transactionId"`
+	Successful     bool   `json:"successful"`
+	ValidationCode string `json:"validationCode"`
+	BlockNumber    uint64 `json:"blockNumber"`
+}
+
+// errSignerNotAllowed is returned when the identity signing an offline message is not the caller's
+var errSignerNotAllowed = errors.New("signer may not transact for the caller")
+
+// offlineGateway connects a gateway for the signer to the organization's peers, after checking that the
+// signer is a member of the organization and, when the caller claims a user, that its certificate was
+// issued to that user. The gateway has no signing implementation; every message it creates is signed by the client.
+func offlineGateway(caller *OrgSetup, signer *msp.SerializedIdentity) (*client.Gateway, error) {
+	certificate, err := identity.CertificateFromPEM(signer.GetIdBytes())
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %v", err)
+	}
+
+	if signer.GetMspid() != caller.MSPID {
+		return nil, fmt.Errorf("%w: certificate of %s cannot transact for %s", errSignerNotAllowed, signer.GetMspid(), caller.OrgName)
+	}
+	if caller.UserName != "" && certificate.Subject.CommonName != caller.UserName {
+		return nil, fmt.Errorf("%w: certificate issued to %q does not belong to %s of %s", errSignerNotAllowed, certificate.Subject.CommonName, caller.UserName, caller.OrgName)
+	}
+
+	id, err := identity.NewX509Identity(signer.GetMspid(), certificate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %v", err)
+	}
+
+	return client.Connect(id, client.WithClientConnection(gateways.Connection(caller.OrgName)))
+}
+
+// respondWithSignerError reports an invalid signer as a bad request and a signer that is not the caller's as forbidden
+func respondWithSignerError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, errSignerNotAllowed) {
+		status = http.StatusForbidden
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// proposalSigner returns the identity that created an offline proposal message
+func proposalSigner(message []byte) (*msp.SerializedIdentity, error) {
+	proposed := &gatewaypb.ProposedTransaction{}
+	if err := proto.Unmarshal(message, proposed); err != nil {
+		return nil, fmt.Errorf("invalid proposal: %v", err)
+	}
+	proposal := &peer.Proposal{}
+	if err := proto.Unmarshal(proposed.GetProposal().GetProposalBytes(), proposal); err != nil {
+		return nil, fmt.Errorf("invalid proposal: %v", err)
+	}
+	header := &common.Header{}
+	if err := proto.Unmarshal(proposal.GetHeader(), header); err != nil {
+		return nil, fmt.Errorf("invalid proposal: %v", err)
+	}
+	return headerCreator(header.GetSignatureHeader())
+}
+
+// transactionSigner returns the identity that created an offline transaction message
+func transactionSigner(message []byte) (*msp.SerializedIdentity, error) {
+	prepared := &gatewaypb.PreparedTransaction{}
+	if err := proto.Unmarshal(message, prepared); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(prepared.GetEnvelope().GetPayload(), payload); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+	return headerCreator(payload.GetHeader().GetSignatureHeader())
+}
+
+// commitSigner returns the identity that created an offline commit status request message
+func commitSigner(message []byte) (*msp.SerializedIdentity, error) {
+	signed := &gatewaypb.SignedCommitStatusRequest{}
+	if err := proto.Unmarshal(message, signed); err != nil {
+		return nil, fmt.Errorf("invalid commit status request: %v", err)
+	}
+	request := &gatewaypb.CommitStatusRequest{}
+	if err := proto.Unmarshal(signed.GetRequest(), request); err != nil {
+		return nil, fmt.Errorf("invalid commit status request: %v", err)
+	}
+	return unmarshalIdentity(request.GetIdentity())
+}
+
+// headerCreator returns the creator of a marshalled signature header
+func headerCreator(signatureHeaderBytes []byte) (*msp.SerializedIdentity, error) {
+	signatureHeader := &common.SignatureHeader{}
+	if err := proto.Unmarshal(signatureHeaderBytes, signatureHeader); err != nil {
+		return nil, fmt.Errorf("invalid signature header: %v", err)
+	}
+	return unmarshalIdentity(signatureHeader.GetCreator())
+}
+
+// unmarshalIdentity parses a serialized identity
+func unmarshalIdentity(identityBytes []byte) (*msp.SerializedIdentity, error) {
+	id := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(identityBytes, id); err != nil {
+		return nil, fmt.Errorf("invalid signer identity: %v", err)
+	}
+	return id, nil
+}
+
+// decodeSignedRequest binds the request body and decodes its message and signature
+func decodeSignedRequest(c *gin.Context) ([]byte, []byte, bool) {
+	var req OfflineSignedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+
+	message, err := base64.StdEncoding.DecodeString(req.Message)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message must be base64-encoded"})
+		return nil, nil, false
+	}
+	signature, err := base64.StdEncoding.DecodeString(req.Signature)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "signature must be base64-encoded"})
+		return nil, nil, false
+	}
+
+	return message, signature, true
+}
+
+// createOfflineProposal builds an unsigned proposal for the client's certificate and returns it with its digest
+func createOfflineProposal(c *gin.Context) {
+	var req OfflineProposalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	setup := requestOrganization(c)
+	gateway, err := offlineGateway(setup, &msp.SerializedIdentity{Mspid: setup.MSPID, IdBytes: []byte(req.Certificate)})
+	if err != nil {
+		respondWithSignerError(c, err)
+		return
+	}
+	defer gateway.Close()
+
+	contract := gateway.GetNetwork(setup.ChannelName).GetContract(setup.ChaincodeName)
+	proposal, err := contract.NewProposal(req.Function, withTraceContext(c.Request.Context(), client.WithArguments(req.Args...))...)
+	if err != nil {
+		respondWithError(c, fmt.Errorf("failed to create transaction proposal: %w", err))
+		return
+	}
+
+	proposalBytes, err := proposal.Bytes()
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, OfflineMessage{
+		TransactionID: proposal.TransactionID(),
+		Message:       base64.StdEncoding.EncodeToString(proposalBytes),
+		Digest:        base64.StdEncoding.EncodeToString(proposal.Digest()),
+	})
+}
+
+// endorseOfflineProposal endorses a client-signed proposal and returns the unsigned transaction with its digest
+func endorseOfflineProposal(c *gin.Context) {
+	message, signature, ok := decodeSignedRequest(c)
+	if !ok {
+		return
+	}
+
+	signer, err := proposalSigner(message)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	gateway, err := offlineGateway(requestOrganization(c), signer)
+	if err != nil {
+		respondWithSignerError(c, err)
+		return
+	}
+	defer gateway.Close()
+
+	proposal, err := gateway.NewSignedProposal(message, signature)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid proposal: %v", err)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutsFromContext(c.Request.Context()).Endorse)
+	defer cancel()
+	transaction, err := proposal.EndorseWithContext(ctx)
+	if err != nil {
+		respondWithError(c, fmt.Errorf("failed to endorse transaction: %w", err))
+		return
+	}
+
+	transactionBytes, err := transaction.Bytes()
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, OfflineMessage{
+		TransactionID: transaction.TransactionID(),
+		Message:       base64.StdEncoding.EncodeToString(transactionBytes),
+		Digest:        base64.StdEncoding.EncodeToString(transaction.Digest()),
+		Result:        base64.StdEncoding.EncodeToString(transaction.Result()),
+	})
+}
+
+// submitOfflineTransaction submits a client-signed transaction to the orderer and returns the unsigned
+// commit status request with its digest
+func submitOfflineTransaction(c *gin.Context) {
+	message, signature, ok := decodeSignedRequest(c)
+	if !ok {
+		return
+	}
+
+	// The commit status request is created for the gateway's identity, so it must be the client's
+	signer, err := transactionSigner(message)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	gateway, err := offlineGateway(requestOrganization(c), signer)
+	if err != nil {
+		respondWithSignerError(c, err)
+		return
+	}
+	defer gateway.Close()
+
+	transaction, err := gateway.NewSignedTransaction(message, signature)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid transaction: %v", err)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutsFromContext(c.Request.Context()).Submit)
+	defer cancel()
+	commit, err := transaction.SubmitWithContext(ctx)
+	if err != nil {
+		respondWithError(c, fmt.Errorf("failed to submit transaction: %w", err))
+		return
+	}
+
+	commitBytes, err := commit.Bytes()
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, OfflineMessage{
+		TransactionID: commit.TransactionID(),
+		Message:       base64.StdEncoding.EncodeToString(commitBytes),
+		Digest:        base64.StdEncoding.EncodeToString(commit.Digest()),
+	})
+}
+
+// getOfflineCommitStatus waits for a transaction to commit using a client-signed commit status request
+func getOfflineCommitStatus(c *gin.Context) {
+	message, signature, ok := decodeSignedRequest(c)
+	if !ok {
+		return
+	}
+
+	signer, err := commitSigner(message)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	gateway, err := offlineGateway(requestOrganization(c), signer)
+	if err != nil {
+		respondWithSignerError(c, err)
+		return
+	}
+	defer gateway.Close()
+
+	commit, err := gateway.NewSignedCommit(message, signature)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid commit status request: %v", err)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutsFromContext(c.Request.Context()).CommitStatus)
+	defer cancel()
+	status, err := commit.StatusWithContext(ctx)
+	if err != nil {
+		respondWithError(c, fmt.Errorf("failed to get commit status: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, OfflineCommitStatus{
+		TransactionID:  status.TransactionID,
+		Successful:     status.Successful,
+		ValidationCode: status.Code.String(),
+		BlockNumber:    status.BlockNumber,
+	})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testCertificate returns a self-signed PEM certificate issued to the common name
+func testCertificate(t *testing.T, commonName string) string {
+	t.Helper()
+	certificate, _ := testCredentials(t, commonName)
+	return certificate
+}
+
+// testCredentials returns a self-signed PEM certificate issued to the common name and its PEM private key
+func testCredentials(t *testing.T, commonName string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+}
+
+// newOfflineRouter serves the offline routes for Org1, whose wallet holds no identities, with
+// HS256 authentication enabled
+func newOfflineRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	auth, err := NewAuthenticator(AuthConfig{HS256Secret: testHS256Secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previousGateways, previousAuthenticator := gateways, authenticator
+	gateways = newTestRegistry(t, NewInMemoryWallet())
+	authenticator = auth
+	t.Cleanup(func() {
+		gateways, authenticator = previousGateways, previousAuthenticator
+	})
+
+	router := gin.New()
+	registerOfflineRoutes(router.Group("/api/v1/offline", selectOrganization))
+	return router
+}
+
+// postOffline posts body to the offline route with the bearer token
+func postOffline(t *testing.T, router *gin.Engine, path, token string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/offline"+path, bytes.NewReader(payload))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestOfflineProposalNeedsNoWalletIdentity(t *testing.T) {
+	router := newOfflineRouter(t)
+
+	w := postOffline(t, router, "/proposals", hs256Token(t, "alice@Org1"), OfflineProposalRequest{
+		Function: "ReadAsset", Args: []string{"asset1"}, Certificate: testCertificate(t, "alice"),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+
+	var proposal OfflineMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &proposal); err != nil {
+		t.Fatal(err)
+	}
+	if proposal.TransactionID == "" || proposal.Message == "" || proposal.Digest == "" {
+		t.Fatalf("expected a proposal to sign, got %+v", proposal)
+	}
+}
+
+func TestOfflineRoutesCheckSigner(t *testing.T) {
+	router := newOfflineRouter(t)
+
+	w := postOffline(t, router, "/proposals", hs256Token(t, "alice@Org1"), OfflineProposalRequest{
+		Function: "ReadAsset", Args: []string{"asset1"}, Certificate: testCertificate(t, "alice"),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+	var proposal OfflineMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &proposal); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		body     interface{}
+		expected int
+	}{
+		{
+			name:     "no token",
+			path:     "/proposals",
+			body:     OfflineProposalRequest{Function: "ReadAsset", Certificate: testCertificate(t, "alice")},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "certificate of another user",
+			path:     "/proposals",
+			token:    hs256Token(t, "alice@Org1"),
+			body:     OfflineProposalRequest{Function: "ReadAsset", Certificate: testCertificate(t, "bob")},
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "unknown organization",
+			path:     "/proposals",
+			token:    hs256Token(t, "alice@Org3"),
+			body:     OfflineProposalRequest{Function: "ReadAsset", Certificate: testCertificate(t, "alice")},
+			expected: http.StatusNotFound,
+		},
+		{
+			name:     "proposal signed by another user",
+			path:     "/endorse",
+			token:    hs256Token(t, "bob@Org1"),
+			body:     OfflineSignedRequest{Message: proposal.Message, Signature: "c2lnbmF0dXJl"},
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "message that is not a proposal",
+			path:     "/endorse",
+			token:    hs256Token(t, "alice@Org1"),
+			body:     OfflineSignedRequest{Message: "bm90IGEgcHJvcG9zYWw=", Signature: "c2lnbmF0dXJl"},
+			expected: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		w := postOffline(t, router, tt.path, tt.token, tt.body)
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.expected, w.Code, w.Body)
+		}
+	}
+}
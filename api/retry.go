@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+)
+
+// retryPolicy controls the resubmission of transactions invalidated by a read conflict
+var retryPolicy = RetryConfig{MaxAttempts: 1}
+
+// retriesHeader reports how often a submitted transaction was endorsed and submitted again
+const retriesHeader = "X-Transaction-Retries"
+
+// retryableCode reports the validation code of a transaction that failed to commit but may succeed
+// when endorsed again against the current world state
+func retryableCode(err error) (peer.TxValidationCode, bool) {
+	var commitErr *CommitFailedError
+	if !errors.As(err, &commitErr) {
+		return 0, false
+	}
+
+	switch commitErr.Code {
+	case peer.TxValidationCode_MVCC_READ_CONFLICT, peer.TxValidationCode_PHANTOM_READ_CONFLICT:
+		return commitErr.Code, true
+	}
+	return 0, false
+}
+
+// backoff returns the delay before the given retry, counting from 1. Half of the delay is random so that
+// clients conflicting on the same keys do not retry in lockstep.
+func (cfg RetryConfig) backoff(retry int) time.Duration {
+	delay := float64(cfg.InitialBackoff) * math.Pow(cfg.Multiplier, float64(retry-1))
+	if delay > float64(cfg.MaxBackoff) {
+		delay = float64(cfg.MaxBackoff)
+	}
+
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// retry runs submit until it succeeds, fails with an error that is not retryable or has been attempted
+// MaxAttempts times, waiting with backoff between attempts. It returns the result and the number of retries.
+func (cfg RetryConfig) retry(ctx context.Context, function string, submit func() ([]byte, error)) ([]byte, int, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := submit()
+		code, retryable := retryableCode(err)
+		if !retryable {
+			return result, attempt - 1, err
+		}
+		if attempt >= cfg.MaxAttempts {
+			retriesExhaustedCount.WithLabelValues(function).Inc()
+			return nil, attempt - 1, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		delay := cfg.backoff(attempt)
+		log.Printf("%s failed with %s, retrying in %v: %v", function, code, delay, err)
+		retryCount.WithLabelValues(function, code.String()).Inc()
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, attempt - 1, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+)
+
+// errEndorsementTest stands in for a failure before the transaction reaches the orderer
+var errEndorsementTest = errors.New("endorsement failed")
+
+// failingSubmit returns a submit function that fails with the errors in turn and then succeeds,
+// counting its calls
+func failingSubmit(calls *int, failures ...error) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		*calls++
+		if *calls <= len(failures) {
+			return nil, failures[*calls-1]
+		}
+		return []byte("ok"), nil
+	}
+}
+
+func TestRetryResubmitsReadConflicts(t *testing.T) {
+	policy := RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Multiplier: 2}
+	mvcc := &CommitFailedError{TransactionID: "tx1", Code: peer.TxValidationCode_MVCC_READ_CONFLICT}
+	phantom := &CommitFailedError{TransactionID: "tx2", Code: peer.TxValidationCode_PHANTOM_READ_CONFLICT}
+	policyFailure := &CommitFailedError{TransactionID: "tx3", Code: peer.TxValidationCode_ENDORSEMENT_POLICY_FAILURE}
+
+	tests := []struct {
+		name     string
+		failures []error
+		calls    int
+		retries  int
+		err      error
+	}{
+		{name: "success", calls: 1},
+		{name: "read conflicts", failures: []error{mvcc, phantom}, calls: 3, retries: 2},
+		{name: "attempts exhausted", failures: []error{mvcc, mvcc, mvcc}, calls: 3, retries: 2, err: mvcc},
+		{name: "other commit failure", failures: []error{policyFailure}, calls: 1, err: policyFailure},
+		{name: "endorsement error", failures: []error{errEndorsementTest}, calls: 1, err: errEndorsementTest},
+	}
+
+	for _, tt := range tests {
+		calls := 0
+		result, retries, err := policy.retry(context.Background(), "TransferAsset", failingSubmit(&calls, tt.failures...))
+		if calls != tt.calls || retries != tt.retries {
+			t.Errorf("%s: expected %d calls and %d retries, got %d and %d", tt.name, tt.calls, tt.retries, calls, retries)
+		}
+		if tt.err == nil {
+			if err != nil || string(result) != "ok" {
+				t.Errorf("%s: expected success, got %q and %v", tt.name, result, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestRetryStopsWhenContextIsDone(t *testing.T) {
+	policy := RetryConfig{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour, Multiplier: 2}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+	conflict := &CommitFailedError{TransactionID: "tx1", Code: peer.TxValidationCode_MVCC_READ_CONFLICT}
+	_, retries, err := policy.retry(ctx, "TransferAsset", failingSubmit(&calls, conflict, conflict))
+	if !errors.Is(err, context.DeadlineExceeded) || calls != 1 || retries != 0 {
+		t.Fatalf("expected to stop during the first backoff, got %d calls, %d retries and %v", calls, retries, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryConfig{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+
+	for retry, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 10: time.Second} {
+		for i := 0; i < 20; i++ {
+			if delay := policy.backoff(retry); delay < max/2 || delay > max {
+				t.Fatalf("retry %d: expected a delay between %v and %v, got %v", retry, max/2, max, delay)
+			}
+		}
+	}
+}
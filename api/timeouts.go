@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// callTimeouts holds the configured gateway call timeouts
+var callTimeouts TimeoutConfig
+
+// callTimeoutsKey stores the timeouts of the request's route in its context
+type callTimeoutsKey struct{}
+
+// applyCallTimeouts stores the gateway call timeouts of the matched route in the request context. The
+// context is cancelled when the client disconnects, which aborts the request's in-flight gateway calls.
+func applyCallTimeouts(c *gin.Context) {
+	timeouts, ok := callTimeouts.Routes[routeKey(c)]
+	if !ok {
+		timeouts = callTimeouts.CallTimeouts
+	}
+
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), callTimeoutsKey{}, timeouts))
+	c.Next()
+}
+
+// routeKey identifies the matched route by method and path below /api/v1, the same for the
+// organization-prefixed routes, e.g. "POST /assets/:id/transfer"
+func routeKey(c *gin.Context) string {
+	path := c.FullPath()
+	if trimmed := strings.TrimPrefix(path, "/api/v1/orgs/:org"); trimmed != path {
+		return c.Request.Method + " " + trimmed
+	}
+	return c.Request.Method + " " + strings.TrimPrefix(path, "/api/v1")
+}
+
+// timeoutsFromContext returns the gateway call timeouts stored by applyCallTimeouts, or the defaults
+func timeoutsFromContext(ctx context.Context) CallTimeouts {
+	if timeouts, ok := ctx.Value(callTimeoutsKey{}).(CallTimeouts); ok {
+		return timeouts
+	}
+	return callTimeouts.CallTimeouts
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRouteTimeoutsInheritDefaults(t *testing.T) {
+	config := `
+timeouts:
+  evaluate: 2s
+  routes:
+    "POST /assets/:id/transfer":
+      endorse: 30s
+`
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(config), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.applyDefaults()
+
+	defaults := CallTimeouts{Evaluate: 2 * time.Second, Endorse: 15 * time.Second, Submit: 5 * time.Second, CommitStatus: time.Minute}
+	if cfg.Timeouts.CallTimeouts != defaults {
+		t.Fatalf("expected defaults %+v, got %+v", defaults, cfg.Timeouts.CallTimeouts)
+	}
+	transfer := defaults
+	transfer.Endorse = 30 * time.Second
+	if route := cfg.Timeouts.Routes["POST /assets/:id/transfer"]; route != transfer {
+		t.Fatalf("expected route timeouts %+v, got %+v", transfer, route)
+	}
+}
+
+func TestApplyCallTimeouts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	previous := callTimeouts
+	callTimeouts = TimeoutConfig{
+		CallTimeouts: CallTimeouts{Endorse: 15 * time.Second},
+		Routes: map[string]CallTimeouts{
+			"POST /assets/:id/transfer": {Endorse: 30 * time.Second},
+			"POST /offline/endorse":     {Endorse: time.Minute},
+		},
+	}
+	t.Cleanup(func() { callTimeouts = previous })
+
+	report := func(c *gin.Context) {
+		c.String(http.StatusOK, timeoutsFromContext(c.Request.Context()).Endorse.String())
+	}
+	router := gin.New()
+	for _, prefix := range []string{"/api/v1", "/api/v1/orgs/:org"} {
+		group := router.Group(prefix, applyCallTimeouts)
+		group.POST("/assets", report)
+		group.POST("/assets/:id/transfer", report)
+		group.POST("/offline/endorse", report)
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/api/v1/assets", "15s"},
+		{"/api/v1/assets/asset1/transfer", "30s"},
+		{"/api/v1/orgs/Org2/assets/asset1/transfer", "30s"},
+		{"/api/v1/orgs/Org2/assets", "15s"},
+		{"/api/v1/offline/endorse", "1m0s"},
+		{"/api/v1/orgs/Org2/offline/endorse", "1m0s"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, nil))
+		if w.Body.String() != tt.expected {
+			t.Errorf("%s: expected an endorse timeout of %s, got %s", tt.path, tt.expected, w.Body)
+		}
+	}
+
+	// Calls made outside a request use the defaults
+	if timeouts := timeoutsFromContext(context.Background()); timeouts.Endorse != 15*time.Second {
+		t.Fatalf("expected the default endorse timeout, got %v", timeouts.Endorse)
+	}
+}
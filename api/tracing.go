@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the API's spans. It records nothing until initTracing installs an exporter, but still
+// passes on the trace context of incoming requests.
+var tracer = otel.Tracer("fabric-api")
+
+// traceContext propagates W3C trace context, both in HTTP headers and in the transient map
+var traceContext = propagation.TraceContext{}
+
+// Span attributes describing a Fabric transaction
+const (
+	channelAttribute        = "fabric.channel"
+	chaincodeAttribute      = "fabric.chaincode"
+	functionAttribute       = "fabric.function"
+	mspIDAttribute          = "fabric.msp_id"
+	transactionIDAttribute  = "fabric.tx_id"
+	validationCodeAttribute = "fabric.validation_code"
+	retriesAttribute        = "fabric.retries"
+)
+
+// initTracing installs the trace exporter selected by the configuration. The returned function flushes
+// the spans not exported yet and stops the exporter.
+func initTracing(ctx context.Context, cfg TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(traceContext, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var output io.Closer
+	switch cfg.Exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		var options []otlptracegrpc.Option
+		if cfg.Endpoint != "" {
+			options = append(options, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		var err error
+		exporter, err = otlptracegrpc.New(ctx, options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+		}
+	case "stdout":
+		var writer io.Writer = os.Stdout
+		if cfg.File != "" {
+			file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open trace file: %w", err)
+			}
+			writer, output = file, file
+		}
+		var err error
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(writer))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout trace exporter: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(*cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if output != nil {
+			output.Close()
+		}
+		return err
+	}, nil
+}
+
+// traceRequests starts a server span for every request, continuing the trace of an incoming traceparent
+// header. The span is named after the route pattern and stored in the request context, so the gateway
+// calls made for the request become its children.
+func traceRequests(c *gin.Context) {
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.method", c.Request.Method),
+			attribute.String("http.route", route),
+		))
+	defer span.End()
+
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+
+	status := c.Writer.Status()
+	span.SetAttributes(attribute.Int("http.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, strconv.Itoa(status))
+	}
+}
+
+// transactionAttributes describes the transaction a span belongs to
+func (setup *OrgSetup) transactionAttributes(function string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String(channelAttribute, setup.ChannelName),
+		attribute.String(chaincodeAttribute, setup.ChaincodeName),
+		attribute.String(functionAttribute, function),
+		attribute.String(mspIDAttribute, setup.MSPID),
+	}
+}
+
+// startGatewayCall starts a client span and a latency measurement for one evaluate, endorse, submit or
+// commit_status call of a transaction. The returned function records the outcome and ends both.
+func (setup *OrgSetup) startGatewayCall(ctx context.Context, call, function, txID string) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, call+" "+function,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(setup.transactionAttributes(function)...),
+		trace.WithAttributes(attribute.String(transactionIDAttribute, txID)))
+
+	return ctx, func(err error) {
+		observeGatewayCall(call, setup.ChaincodeName, function, start, err)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// withTraceContext puts the trace context of ctx in the proposal's transient map. A later option that sets
+// a transient map replaces it, so callers passing private data add the trace context with traceTransient.
+func withTraceContext(ctx context.Context, options ...client.ProposalOption) []client.ProposalOption {
+	return append([]client.ProposalOption{client.WithTransient(traceTransient(ctx, nil))}, options...)
+}
+
+// traceTransient returns a copy of the transient map with the trace context of ctx added under the W3C
+// traceparent and tracestate keys, so that the chaincode can log the trace its transaction belongs to
+func traceTransient(ctx context.Context, transient map[string][]byte) map[string][]byte {
+	carrier := propagation.MapCarrier{}
+	traceContext.Inject(ctx, carrier)
+
+	traced := make(map[string][]byte, len(transient)+len(carrier))
+	for key, value := range transient {
+		traced[key] = value
+	}
+	for key, value := range carrier {
+		traced[key] = []byte(value)
+	}
+	return traced
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gatewaypb "github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/proto"
+)
+
+// testTraceparent is the W3C traceparent of testSpanContext
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// testSpanContext is a sampled span of a remote trace
+var testSpanContext = trace.NewSpanContext(trace.SpanContextConfig{
+	TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+	SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	TraceFlags: trace.FlagsSampled,
+	Remote:     true,
+})
+
+// transientGateway is a gateway service that records the transient map of the proposals it evaluates
+type transientGateway struct {
+	gatewaypb.UnimplementedGatewayServer
+	transient map[string][]byte
+}
+
+func (g *transientGateway) Evaluate(_ context.Context, request *gatewaypb.EvaluateRequest) (*gatewaypb.EvaluateResponse, error) {
+	proposal := &peer.Proposal{}
+	if err := proto.Unmarshal(request.GetProposedTransaction().GetProposalBytes(), proposal); err != nil {
+		return nil, err
+	}
+	payload := &peer.ChaincodeProposalPayload{}
+	if err := proto.Unmarshal(proposal.GetPayload(), payload); err != nil {
+		return nil, err
+	}
+	g.transient = payload.GetTransientMap()
+	return &gatewaypb.EvaluateResponse{Result: &peer.Response{Status: 200}}, nil
+}
+
+func TestTraceTransient(t *testing.T) {
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), testSpanContext)
+	private := map[string][]byte{"asset_properties": []byte(`{"appraisedValue":300}`)}
+
+	traced := traceTransient(ctx, private)
+	expected := map[string][]byte{
+		"asset_properties": []byte(`{"appraisedValue":300}`),
+		"traceparent":      []byte(testTraceparent),
+	}
+	if !reflect.DeepEqual(traced, expected) {
+		t.Fatalf("expected %q, got %q", expected, traced)
+	}
+	if _, ok := private["traceparent"]; ok {
+		t.Fatal("expected the caller's transient map to be left unchanged")
+	}
+
+	// Without a trace there is nothing to add
+	if traced := traceTransient(context.Background(), private); !reflect.DeepEqual(traced, private) {
+		t.Fatalf("expected only the private data, got %q", traced)
+	}
+}
+
+func TestEvaluateSendsTraceContextWithPrivateData(t *testing.T) {
+	gateway := &transientGateway{}
+	setup := &OrgSetup{OrgName: "Org1", MSPID: "Org1MSP", ChannelName: "mychannel", ChaincodeName: "basic", Gateway: *newTestGateway(t, gateway)}
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), testSpanContext)
+	ctx = context.WithValue(ctx, callTimeoutsKey{}, CallTimeouts{Evaluate: time.Second})
+
+	if _, err := setup.evaluateTransaction(ctx, "ReadAsset", "asset1"); err != nil {
+		t.Fatal(err)
+	}
+	if traceparent := string(gateway.transient["traceparent"]); traceparent != testTraceparent {
+		t.Fatalf("expected the proposal to carry traceparent %s, got %q", testTraceparent, gateway.transient)
+	}
+
+	private := map[string][]byte{"asset_properties": []byte(`{"appraisedValue":300}`)}
+	if _, err := setup.evaluateTransactionWithTransient(ctx, "ReadAssetPrivateDetails", private, "asset1"); err != nil {
+		t.Fatal(err)
+	}
+	if string(gateway.transient["traceparent"]) != testTraceparent || string(gateway.transient["asset_properties"]) != `{"appraisedValue":300}` {
+		t.Fatalf("expected the proposal to carry both the private data and the trace context, got %q", gateway.transient)
+	}
+}
+
+func TestTraceRequestsContinuesIncomingTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Propagation is installed even when no spans are exported
+	previous := otel.GetTextMapPropagator()
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+	if _, err := initTracing(context.Background(), TracingConfig{Exporter: "none"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var spanContext trace.SpanContext
+	router := gin.New()
+	router.Use(traceRequests)
+	router.GET("/api/v1/assets/:id", func(c *gin.Context) {
+		spanContext = trace.SpanContextFromContext(c.Request.Context())
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/assets/asset1", nil)
+	r.Header.Set("traceparent", testTraceparent)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	if spanContext.TraceID() != testSpanContext.TraceID() {
+		t.Fatalf("expected the request to continue trace %s, got %s", testSpanContext.TraceID(), spanContext.TraceID())
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// Commit states of a transaction submitted asynchronously
+const (
+	transactionPending   = "PENDING"
+	transactionCommitted = "COMMITTED"
+	transactionInvalid   = "INVALID"
+	transactionUnknown   = "UNKNOWN"
+)
+
+// transactionRetention is how long the status of a finished transaction stays available
+const transactionRetention = time.Hour
+
+// transactions tracks the transactions submitted with ?async=true
+var transactions = NewTransactionTracker()
+
+// TransactionStatus represents the commit status of a transaction submitted asynchronously
+type TransactionStatus struct {
+	TransactionID  string     `json:"transactionId"`
+	Status         string     `json:"status"`
+	ValidationCode string     `json:"validationCode,omitempty"`
+	BlockNumber    uint64     `json:"blockNumber,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	SubmittedAt    time.Time  `json:"submittedAt"`
+	FinishedAt     *time.Time `json:"finishedAt,omitempty"`
+
+	org string
+}
+
+// TransactionTracker waits for the commit status of submitted transactions in the background, so the
+// request that submitted a transaction can return as soon as the orderer has accepted it
+type TransactionTracker struct {
+	mu       sync.Mutex
+	statuses map[string]*TransactionStatus
+}
+
+// NewTransactionTracker creates an empty transaction tracker
+func NewTransactionTracker() *TransactionTracker {
+	return &TransactionTracker{statuses: make(map[string]*TransactionStatus)}
+}
+
+// Track records a transaction submitted by the organization identity as pending and waits for its commit
+// status. The wait outlives the request but stays part of the request's trace.
+func (t *TransactionTracker) Track(ctx context.Context, setup *OrgSetup, function string, commit *client.Commit) TransactionStatus {
+	status := &TransactionStatus{
+		TransactionID: commit.TransactionID(),
+		Status:        transactionPending,
+		SubmittedAt:   time.Now(),
+		org:           setup.OrgName,
+	}
+
+	t.mu.Lock()
+	t.prune()
+	t.statuses[status.TransactionID] = status
+	snapshot := *status
+	t.mu.Unlock()
+
+	go t.wait(context.WithoutCancel(ctx), status, setup, function, commit)
+
+	return snapshot
+}
+
+// wait blocks until the commit status of the transaction is known and records it. It waits for as long
+// as the commitStatus timeout of the submitting route, after which the status is unknown.
+func (t *TransactionTracker) wait(ctx context.Context, status *TransactionStatus, setup *OrgSetup, function string, commit *client.Commit) {
+	ctx, cancel := context.WithTimeout(ctx, timeoutsFromContext(ctx).CommitStatus)
+	defer cancel()
+
+	result, err := setup.commitStatus(ctx, function, commit)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	status.FinishedAt = &now
+	if err != nil {
+		status.Status = transactionUnknown
+		status.Error = fmt.Sprintf("failed to get commit status: %v", err)
+		log.Printf("Commit status of transaction %s is unknown: %v", status.TransactionID, err)
+		return
+	}
+
+	status.ValidationCode = result.Code.String()
+	status.BlockNumber = result.BlockNumber
+	if result.Successful {
+		status.Status = transactionCommitted
+	} else {
+		status.Status = transactionInvalid
+		log.Printf("Transaction %s committed as invalid with code %s", status.TransactionID, status.ValidationCode)
+	}
+}
+
+// Get returns the status of a transaction submitted by the organization
+func (t *TransactionTracker) Get(org, txID string) (TransactionStatus, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status, ok := t.statuses[txID]
+	if !ok || status.org != org {
+		return TransactionStatus{}, false
+	}
+	return *status, true
+}
+
+// prune forgets finished transactions older than the retention period; the caller holds the lock
+func (t *TransactionTracker) prune() {
+	cutoff := time.Now().Add(-transactionRetention)
+	for txID, status := range t.statuses {
+		if status.FinishedAt != nil && status.FinishedAt.Before(cutoff) {
+			delete(t.statuses, txID)
+		}
+	}
+}
+
+// asyncRequested reports whether the client asked not to wait for the transaction to commit
+func asyncRequested(c *gin.Context) bool {
+	return c.Query("async") == "true"
+}
+
+// submitRequestTransaction submits a transaction as the request's identity. With ?async=true it
+// responds 202 with the transaction ID once the orderer has accepted the transaction; otherwise it waits
+// for the commit. It reports whether the transaction committed and the handler should write its response.
+func submitRequestTransaction(c *gin.Context, function string, options ...client.ProposalOption) bool {
+	setup := requestGateway(c)
+
+	if !asyncRequested(c) {
+		_, retries, err := setup.submitTransactionWithOptions(c.Request.Context(), function, options...)
+		c.Header(retriesHeader, strconv.Itoa(retries))
+		if err != nil {
+			respondWithError(c, err)
+			return false
+		}
+		return true
+	}
+
+	_, commit, err := setup.submitAsync(c.Request.Context(), function, options...)
+	if err != nil {
+		respondWithError(c, err)
+		return false
+	}
+
+	status := transactions.Track(c.Request.Context(), setup, function, commit)
+	c.Header("Location", fmt.Sprintf("%s/transactions/%s/status", routePrefix(c), status.TransactionID))
+	c.JSON(http.StatusAccepted, status)
+	return false
+}
+
+// routePrefix returns the API prefix the request was routed through, /api/v1 or /api/v1/orgs/:org
+func routePrefix(c *gin.Context) string {
+	if org := c.Param("org"); org != "" {
+		return "/api/v1/orgs/" + org
+	}
+	return "/api/v1"
+}
+
+// getTransactionStatus reports the commit status of a transaction submitted with ?async=true
+func getTransactionStatus(c *gin.Context) {
+	txID := c.Param("txId")
+
+	status, ok := transactions.Get(requestGateway(c).OrgName, txID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("transaction %s is not tracked", txID)})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
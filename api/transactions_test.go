@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// finishedAt returns a pointer to the time the given duration ago
+func finishedAt(ago time.Duration) *time.Time {
+	finished := time.Now().Add(-ago)
+	return &finished
+}
+
+func TestTransactionTrackerPrunesFinishedTransactions(t *testing.T) {
+	tracker := NewTransactionTracker()
+	tracker.statuses = map[string]*TransactionStatus{
+		"expired": {TransactionID: "expired", Status: transactionCommitted, FinishedAt: finishedAt(transactionRetention + time.Minute), org: "Org1"},
+		"recent":  {TransactionID: "recent", Status: transactionInvalid, FinishedAt: finishedAt(transactionRetention - time.Minute), org: "Org1"},
+		"unknown": {TransactionID: "unknown", Status: transactionUnknown, FinishedAt: finishedAt(2 * transactionRetention), org: "Org1"},
+		"pending": {TransactionID: "pending", Status: transactionPending, SubmittedAt: time.Now().Add(-2 * transactionRetention), org: "Org1"},
+	}
+
+	tracker.mu.Lock()
+	tracker.prune()
+	tracker.mu.Unlock()
+
+	// Pending transactions are kept however old they are, so their status can still be reported
+	for txID, kept := range map[string]bool{"expired": false, "recent": true, "unknown": false, "pending": true} {
+		if _, ok := tracker.Get("Org1", txID); ok != kept {
+			t.Errorf("%s: expected kept to be %v", txID, kept)
+		}
+	}
+}
+
+func TestTransactionStatusIsScopedToOrganization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	previous := transactions
+	transactions = NewTransactionTracker()
+	t.Cleanup(func() { transactions = previous })
+	transactions.statuses["tx1"] = &TransactionStatus{TransactionID: "tx1", Status: transactionCommitted, ValidationCode: "VALID", BlockNumber: 7, org: "Org1"}
+
+	router := gin.New()
+	for _, org := range []string{"Org1", "Org2"} {
+		setup := &OrgSetup{OrgName: org}
+		router.GET("/"+org+"/transactions/:txId/status", func(c *gin.Context) { c.Set(gatewayContextKey, setup) }, getTransactionStatus)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/Org1/transactions/tx1/status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	var status TransactionStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != transactionCommitted || status.BlockNumber != 7 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	// Another organization cannot learn about the transaction
+	for _, path := range []string{"/Org2/transactions/tx1/status", "/Org1/transactions/tx2/status"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected %d, got %d: %s", path, http.StatusNotFound, w.Code, w.Body)
+		}
+	}
+}
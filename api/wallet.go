@@ -0,0 +1,289 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// errIdentityNotFound is returned by wallets that hold no identity with the requested label
+var errIdentityNotFound = errors.New("identity not found in wallet")
+
+// WalletIdentity is an X.509 identity held in a wallet, stored in the same layout as the Fabric SDK wallets
+type WalletIdentity struct {
+	Version     int               `json:"version"`
+	MSPID       string            `json:"mspId"`
+	Type        string            `json:"type"`
+	Credentials WalletCredentials `json:"credentials"`
+}
+
+// WalletCredentials holds the PEM-encoded certificate and private key of a wallet identity
+type WalletCredentials struct {
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"privateKey"`
+}
+
+// NewWalletIdentity creates an X.509 wallet identity from a PEM-encoded certificate and private key
+func NewWalletIdentity(mspID string, certificatePEM, privateKeyPEM []byte) *WalletIdentity {
+	return &WalletIdentity{
+		Version: 1,
+		MSPID:   mspID,
+		Type:    "X.509",
+		Credentials: WalletCredentials{
+			Certificate: string(certificatePEM),
+			PrivateKey:  string(privateKeyPEM),
+		},
+	}
+}
+
+// Wallet stores X.509 identities by label
+type Wallet interface {
+	Put(label string, id *WalletIdentity) error
+	Get(label string) (*WalletIdentity, error)
+	List() ([]string, error)
+	Remove(label string) error
+}
+
+// walletLabel is the label under which a user of an organization is kept in the wallet
+func walletLabel(org, user string) string {
+	return user + "@" + org
+}
+
+// newIdentity creates the gateway client identity of the wallet identity
+func (id *WalletIdentity) newIdentity() (*identity.X509Identity, error) {
+	certificate, err := identity.CertificateFromPEM([]byte(id.Credentials.Certificate))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return identity.NewX509Identity(id.MSPID, certificate)
+}
+
+// newSign creates a function that signs message digests with the wallet identity's private key
+func (id *WalletIdentity) newSign() (identity.Sign, error) {
+	privateKey, err := identity.PrivateKeyFromPEM([]byte(id.Credentials.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	return identity.NewPrivateKeySign(privateKey)
+}
+
+// loadMSPIdentity reads an identity from an MSP folder: the certificate file and, from the keystore
+// directory, the private key that matches the certificate's public key
+func loadMSPIdentity(mspID, certPath, keyPath string) (*WalletIdentity, error) {
+	certificatePEM, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate file: %w", err)
+	}
+	certificate, err := identity.CertificateFromPEM(certificatePEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s: %w", certPath, err)
+	}
+
+	files, err := ioutil.ReadDir(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key directory: %w", err)
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		privateKeyPEM, err := ioutil.ReadFile(filepath.Join(keyPath, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key file: %w", err)
+		}
+		privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+		if err != nil {
+			continue
+		}
+
+		if keyMatchesCertificate(privateKey, certificate) {
+			return NewWalletIdentity(mspID, certificatePEM, privateKeyPEM), nil
+		}
+	}
+
+	return nil, fmt.Errorf("no private key in %s matches certificate %s", keyPath, certPath)
+}
+
+// keyMatchesCertificate reports whether the private key belongs to the certificate's public key
+func keyMatchesCertificate(privateKey crypto.PrivateKey, certificate *x509.Certificate) bool {
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	publicKey, ok := certificate.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && publicKey.Equal(signer.Public())
+}
+
+// FileSystemWallet keeps each identity in a <label>.id JSON file in a directory
+type FileSystemWallet struct {
+	dir string
+}
+
+// NewFileSystemWallet opens a wallet in the directory, creating the directory if needed
+func NewFileSystemWallet(dir string) (*FileSystemWallet, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create wallet directory: %w", err)
+	}
+	return &FileSystemWallet{dir: dir}, nil
+}
+
+// path returns the file of the labelled identity, rejecting labels that would escape the wallet directory
+func (w *FileSystemWallet) path(label string) (string, error) {
+	if label == "" || strings.ContainsAny(label, `/\`) || label == "." || label == ".." {
+		return "", fmt.Errorf("invalid wallet label %q", label)
+	}
+	return filepath.Join(w.dir, label+".id"), nil
+}
+
+// Put stores the identity under the label, replacing any identity already there
+func (w *FileSystemWallet) Put(label string, id *WalletIdentity) error {
+	file, err := w.path(label)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(id)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it so a crash never leaves a truncated identity
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write wallet identity: %w", err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return fmt.Errorf("failed to write wallet identity: %w", err)
+	}
+
+	return nil
+}
+
+// Get returns the labelled identity
+func (w *FileSystemWallet) Get(label string) (*WalletIdentity, error) {
+	file, err := w.path(label)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errIdentityNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wallet identity: %w", err)
+	}
+
+	var id WalletIdentity
+	if err := json.Unmarshal(data, &id); err != nil {
+		return nil, fmt.Errorf("failed to parse wallet identity %s: %w", label, err)
+	}
+
+	return &id, nil
+}
+
+// List returns the labels of all identities in the wallet
+func (w *FileSystemWallet) List() ([]string, error) {
+	files, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wallet directory: %w", err)
+	}
+
+	labels := []string{}
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".id") {
+			labels = append(labels, strings.TrimSuffix(file.Name(), ".id"))
+		}
+	}
+
+	return labels, nil
+}
+
+// Remove deletes the labelled identity
+func (w *FileSystemWallet) Remove(label string) error {
+	file, err := w.path(label)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return errIdentityNotFound
+	}
+	return err
+}
+
+// InMemoryWallet keeps identities in memory only, so they are lost when the API stops
+type InMemoryWallet struct {
+	mu         sync.RWMutex
+	identities map[string]*WalletIdentity
+}
+
+// NewInMemoryWallet creates an empty in-memory wallet
+func NewInMemoryWallet() *InMemoryWallet {
+	return &InMemoryWallet{identities: make(map[string]*WalletIdentity)}
+}
+
+// Put stores the identity under the label, replacing any identity already there
+func (w *InMemoryWallet) Put(label string, id *WalletIdentity) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	stored := *id
+	w.identities[label] = &stored
+	return nil
+}
+
+// Get returns the labelled identity
+func (w *InMemoryWallet) Get(label string) (*WalletIdentity, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	id, ok := w.identities[label]
+	if !ok {
+		return nil, errIdentityNotFound
+	}
+
+	stored := *id
+	return &stored, nil
+}
+
+// List returns the labels of all identities in the wallet
+func (w *InMemoryWallet) List() ([]string, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	labels := make([]string, 0, len(w.identities))
+	for label := range w.identities {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	return labels, nil
+}
+
+// Remove deletes the labelled identity
+func (w *InMemoryWallet) Remove(label string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.identities[label]; !ok {
+		return errIdentityNotFound
+	}
+	delete(w.identities, label)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// adminOU is the organizational unit carried by admin certificates when NodeOUs are enabled
+const adminOU = "admin"
+
+// AuthorizationError is returned when the submitting client may not change an asset
+type AuthorizationError struct {
+	AssetID  string
+	MSPID    string
+	ClientID string
+}
+
+func (e *AuthorizationError) Error() string {
+	return fmt.Sprintf("[%s] client %s of %s is not allowed to modify asset %s", ErrCodeForbidden, e.ClientID, e.MSPID, e.AssetID)
+}
+
+// submittingClient returns the MSP ID and X.509 identity of the client that submitted the transaction.
+// The identity has the form x509::<subject>::<issuer>.
+func submittingClient(ctx contractapi.TransactionContextInterface) (string, string, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+
+	encodedID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get client identity: %v", err)
+	}
+	clientID, err := base64.StdEncoding.DecodeString(encodedID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode client identity: %v", err)
+	}
+
+	return mspID, string(clientID), nil
+}
+
+// isOrgAdmin reports whether the submitting client holds an admin certificate of its organization
+func isOrgAdmin(ctx contractapi.TransactionContextInterface) (bool, error) {
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return false, fmt.Errorf("failed to get client certificate: %v", err)
+	}
+
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if ou == adminOU {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// requireOrgAdmin returns a FORBIDDEN error unless the submitting client is an admin of its organization.
+// It guards the maintenance functions that rewrite state across all assets.
+func requireOrgAdmin(ctx contractapi.TransactionContextInterface, function string) error {
+	admin, err := isOrgAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return newError(ErrCodeForbidden, "only an org admin may call %s", function)
+	}
+
+	return nil
+}
+
+// authorizeAssetChange checks that the submitting client owns the asset or is an admin of the owning org.
+// Assets created before ownership was recorded have no owner MSP and may not be changed by anyone, since
+// there is no org whose admins could be trusted with them.
+func authorizeAssetChange(ctx contractapi.TransactionContextInterface, asset *Asset) error {
+	mspID, clientID, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	if asset.OwnerMSP == "" || mspID != asset.OwnerMSP {
+		return &AuthorizationError{AssetID: asset.ID, MSPID: mspID, ClientID: clientID}
+	}
+
+	if clientID == asset.OwnerIdentity {
+		return nil
+	}
+
+	admin, err := isOrgAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if admin {
+		return nil
+	}
+
+	return &AuthorizationError{AssetID: asset.ID, MSPID: mspID, ClientID: clientID}
+}
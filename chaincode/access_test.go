@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// expectForbidden fails the test unless err is an AuthorizationError
+func expectForbidden(t *testing.T, err error) {
+	t.Helper()
+	var authErr *AuthorizationError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("expected an authorization error, got %v", err)
+	}
+	expectCode(t, err, ErrCodeForbidden)
+}
+
+func TestOwnerAndAdminAuthorization(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  *fakeClient
+		allowed bool
+	}{
+		{"owner", bankUser, true},
+		{"admin of the owning org", bankAdmin, true},
+		{"other client of the owning org", bankUser2, false},
+		{"client of another org", insuranceUser, false},
+		{"admin of another org", insuranceAdmin, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newFakeStub()
+			contract := new(SmartContract)
+			createAssets(t, stub, bankUser, 3, "Tomoko")
+			before := stub.snapshot()
+
+			changes := map[string]func() error{
+				"UpdateAsset": func() error { return contract.UpdateAsset(stub.as(tt.client), "asset1", "red", 7, 400) },
+				"TransferAsset": func() error {
+					return contract.TransferAsset(stub.as(tt.client), "asset2", "Brad", insuranceUser.mspID, insuranceUser.id())
+				},
+				"DeleteAsset": func() error { return contract.DeleteAsset(stub.as(tt.client), "asset3") },
+			}
+			for function, change := range changes {
+				err := change()
+				if tt.allowed && err != nil {
+					t.Errorf("%s: expected success, got %v", function, err)
+				}
+				if !tt.allowed {
+					expectForbidden(t, err)
+					if stub.lastEvent != "" {
+						t.Errorf("%s: a rejected change emitted %s", function, stub.lastEvent)
+					}
+				}
+			}
+
+			if !tt.allowed {
+				if !reflect.DeepEqual(stub.snapshot(), before) {
+					t.Fatal("a rejected change modified the world state")
+				}
+				return
+			}
+			expectHistory(t, stub, "asset1", [2]string{"CREATE", "Tomoko"}, [2]string{"UPDATE", "Tomoko"})
+			expectHistory(t, stub, "asset2", [2]string{"CREATE", "Tomoko"}, [2]string{"TRANSFER", "Brad"})
+			expectHistory(t, stub, "asset3", [2]string{"CREATE", "Tomoko"}, [2]string{"DELETE", "Tomoko"})
+			checkOwnerIndex(t, stub)
+		})
+	}
+}
+
+func TestTransferHandsOverControl(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 1, "Tomoko")
+
+	err := contract.TransferAsset(stub.as(bankUser), "asset1", "Brad", insuranceUser.mspID, insuranceUser.id())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := expectEvent(t, stub, EventAssetTransferred)
+	if event.AssetID != "asset1" || event.PreviousOwner != "Tomoko" || event.Owner != "Brad" || event.Asset == nil || event.Asset.OwnerMSP != insuranceUser.mspID {
+		t.Fatalf("unexpected transfer event: %+v", event)
+	}
+	expectHistory(t, stub, "asset1", [2]string{"CREATE", "Tomoko"}, [2]string{"TRANSFER", "Brad"})
+	checkOwnerIndex(t, stub)
+	if assets, err := contract.GetAssetsByOwner(stub.as(bankUser), "Tomoko"); err != nil || len(assets) != 0 {
+		t.Fatalf("expected no assets of Tomoko, got %d (%v)", len(assets), err)
+	}
+
+	// The previous owner and its org admin lose control, the new owner and its org admin gain it
+	expectForbidden(t, contract.UpdateAsset(stub.as(bankUser), "asset1", "red", 5, 300))
+	expectForbidden(t, contract.UpdateAsset(stub.as(bankAdmin), "asset1", "red", 5, 300))
+	err = contract.UpdateAsset(stub.as(insuranceUser), "asset1", "red", 5, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = contract.UpdateAsset(stub.as(insuranceAdmin), "asset1", "green", 5, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAssetWithoutOwnerMSPCannotBeChanged(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	putJSON(t, stub, "asset1", Asset{ID: "asset1", Color: "blue", Size: 5, Owner: "Tomoko"})
+
+	for _, client := range []*fakeClient{bankUser, bankAdmin, insuranceAdmin} {
+		expectForbidden(t, contract.TransferAsset(stub.as(client), "asset1", "Brad", client.mspID, client.id()))
+		expectForbidden(t, contract.DeleteAsset(stub.as(client), "asset1"))
+	}
+}
+
+func TestTransferAssetRequiresNewOwner(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 1, "Tomoko")
+
+	for _, args := range [][3]string{
+		{"", insuranceUser.mspID, insuranceUser.id()},
+		{"Brad", "", insuranceUser.id()},
+		{"Brad", insuranceUser.mspID, ""},
+	} {
+		err := contract.TransferAsset(stub.as(bankUser), "asset1", args[0], args[1], args[2])
+		expectCode(t, err, ErrCodeInvalidArgument)
+	}
+}
+
+func TestUpdateAssetKeepsOwner(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 1, "Tomoko")
+
+	err := contract.UpdateAsset(stub.as(bankUser), "asset1", "red", 7, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := expectEvent(t, stub, EventAssetUpdated)
+	if event.AssetID != "asset1" || event.PreviousOwner != "Tomoko" || event.Asset == nil || event.Asset.Color != "red" {
+		t.Fatalf("unexpected update event: %+v", event)
+	}
+	expectHistory(t, stub, "asset1", [2]string{"CREATE", "Tomoko"}, [2]string{"UPDATE", "Tomoko"})
+
+	asset, err := contract.ReadAsset(stub.as(bankUser), "asset1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.Owner != "Tomoko" || asset.OwnerMSP != bankUser.mspID || asset.OwnerIdentity != bankUser.id() {
+		t.Fatalf("update changed the owner: %+v", asset)
+	}
+	if asset.Color != "red" || asset.Size != 7 {
+		t.Fatalf("update was not applied: %+v", asset)
+	}
+}
+
+func TestInitLedgerRequiresAdminAndKeepsExistingAssets(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+
+	expectCode(t, contract.InitLedger(stub.as(bankUser)), ErrCodeForbidden)
+
+	err := contract.InitLedger(stub.as(bankAdmin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := expectEvent(t, stub, EventLedgerInitialized); len(event.AssetIDs) != 10 {
+		t.Fatalf("expected the event to list 10 assets, got %v", event.AssetIDs)
+	}
+	err = contract.TransferAsset(stub.as(bankAdmin), "asset1", "Brad", insuranceUser.mspID, insuranceUser.id())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Running it again, even as an admin of another org, does not take the asset back
+	err = contract.InitLedger(stub.as(insuranceAdmin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	asset, err := contract.ReadAsset(stub.as(bankUser), "asset1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.Owner != "Brad" || asset.OwnerIdentity != insuranceUser.id() {
+		t.Fatalf("InitLedger reset an existing asset: %+v", asset)
+	}
+
+	asset, err = contract.ReadAsset(stub.as(bankUser), "asset2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.OwnerMSP != bankAdmin.mspID {
+		t.Fatalf("InitLedger changed the owner MSP of asset2 to %s", asset.OwnerMSP)
+	}
+}
+
+func TestDeleteAssetRemovesStateAndIndex(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 2, "Tomoko")
+
+	err := contract.DeleteAsset(stub.as(bankUser), "asset1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := expectEvent(t, stub, EventAssetDeleted)
+	if event.AssetID != "asset1" || event.PreviousOwner != "Tomoko" || event.Asset != nil {
+		t.Fatalf("unexpected delete event: %+v", event)
+	}
+	if stub.State["asset1"] != nil {
+		t.Fatal("asset1 is still in the world state")
+	}
+	checkOwnerIndex(t, stub)
+	expectHistory(t, stub, "asset1", [2]string{"CREATE", "Tomoko"}, [2]string{"DELETE", "Tomoko"})
+	expectCode(t, contract.DeleteAsset(stub.as(bankUser), "asset1"), ErrCodeNotFound)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// appraisalTransientKey is the transient map key carrying the appraisal, so that the value
+// never appears in the transaction arguments recorded on the ledger
+const appraisalTransientKey = "asset_appraisal"
+
+// appraisalCollectionSuffix is appended to an org's MSP ID to name its private appraisal collection,
+// see collections_config.json
+const appraisalCollectionSuffix = "AppraisalCollection"
+
+// AssetAppraisal is the private appraisal of an asset kept in the owning org's collection.
+// The salt keeps the on-chain hash from being reversed by trying likely values.
+type AssetAppraisal struct {
+	AssetID        string `json:"assetId"`
+	AppraisedValue int    `json:"appraisedValue"`
+	Salt           string `json:"salt"`
+}
+
+// appraisalCollection returns the name of the private collection of the given org
+func appraisalCollection(mspID string) string {
+	return mspID + appraisalCollectionSuffix
+}
+
+// appraisalFromTransient reads and validates the appraisal passed in the transient map
+func appraisalFromTransient(ctx contractapi.TransactionContextInterface, assetID string) ([]byte, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transient data: %v", err)
+	}
+
+	transientJSON, ok := transientMap[appraisalTransientKey]
+	if !ok {
+		return nil, newError(ErrCodeInvalidArgument, "%s must be passed in the transient map", appraisalTransientKey)
+	}
+
+	var appraisal AssetAppraisal
+	err = json.Unmarshal(transientJSON, &appraisal)
+	if err != nil {
+		return nil, newError(ErrCodeInvalidArgument, "failed to parse %s: %v", appraisalTransientKey, err)
+	}
+	if appraisal.Salt == "" {
+		return nil, newError(ErrCodeInvalidArgument, "the appraisal salt must not be empty")
+	}
+	if appraisal.AppraisedValue <= 0 {
+		return nil, newError(ErrCodeInvalidArgument, "the appraised value must be a positive integer")
+	}
+
+	// Re-marshal the canonical form so that the stored bytes, and their hash, do not depend on
+	// how the client formatted its JSON
+	appraisal.AssetID = assetID
+	return json.Marshal(appraisal)
+}
+
+// SetAssetAppraisal stores the appraisal passed in the transient map in the owning org's private collection.
+// It writes nothing to the public state, so the collection's endorsement policy alone governs it and only
+// peers of the owning org, which may see the appraisal, need to endorse it.
+func (s *SmartContract) SetAssetAppraisal(ctx contractapi.TransactionContextInterface, id string) error {
+	asset, err := s.ReadAsset(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = authorizeAssetChange(ctx, asset)
+	if err != nil {
+		return err
+	}
+
+	appraisalJSON, err := appraisalFromTransient(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// authorizeAssetChange only admits clients of the owning org, so this is also the submitter's collection
+	err = ctx.GetStub().PutPrivateData(appraisalCollection(asset.OwnerMSP), id, appraisalJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put appraisal into private data collection: %v", err)
+	}
+
+	return nil
+}
+
+// ReadAssetAppraisal returns the private appraisal of an asset from the owning org's collection,
+// which only members of that org can read
+func (s *SmartContract) ReadAssetAppraisal(ctx contractapi.TransactionContextInterface, id string) (*AssetAppraisal, error) {
+	asset, err := s.ReadAsset(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	appraisalJSON, err := ctx.GetStub().GetPrivateData(appraisalCollection(asset.OwnerMSP), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read appraisal from private data collection: %v", err)
+	}
+	if appraisalJSON == nil {
+		return nil, newError(ErrCodeNotFound, "no appraisal of asset %s exists in %s", id, appraisalCollection(asset.OwnerMSP))
+	}
+
+	var appraisal AssetAppraisal
+	err = json.Unmarshal(appraisalJSON, &appraisal)
+	if err != nil {
+		return nil, err
+	}
+
+	return &appraisal, nil
+}
+
+// VerifyAppraisal checks the appraisal claimed in the transient map against the hash of the appraisal
+// stored in the owning org's collection. Any org can verify, since every peer of the channel holds the
+// hashes of the private data.
+func (s *SmartContract) VerifyAppraisal(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	asset, err := s.ReadAsset(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	claimedJSON, err := appraisalFromTransient(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	storedHash, err := ctx.GetStub().GetPrivateDataHash(appraisalCollection(asset.OwnerMSP), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to read appraisal hash: %v", err)
+	}
+	if storedHash == nil {
+		return false, newError(ErrCodeNotFound, "no appraisal of asset %s exists in %s", id, appraisalCollection(asset.OwnerMSP))
+	}
+
+	claimedHash := sha256.Sum256(claimedJSON)
+	return bytes.Equal(claimedHash[:], storedHash), nil
+}
+
+// deleteAppraisal removes the appraisal of an asset, if any, from the owning org's collection.
+// It is called when the asset is deleted or leaves the org, as a new owner cannot read the old owner's collection.
+func deleteAppraisal(ctx contractapi.TransactionContextInterface, asset *Asset) error {
+	collection := appraisalCollection(asset.OwnerMSP)
+	hash, err := ctx.GetStub().GetPrivateDataHash(collection, asset.ID)
+	if err != nil {
+		return fmt.Errorf("failed to read appraisal hash: %v", err)
+	}
+	if hash == nil {
+		return nil
+	}
+
+	err = ctx.GetStub().DelPrivateData(collection, asset.ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete appraisal from private data collection: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// withAppraisal puts the appraisal in the transient map of the next transaction
+func withAppraisal(t *testing.T, stub *fakeStub, value int, salt string) {
+	t.Helper()
+	appraisalJSON, err := json.Marshal(AssetAppraisal{AppraisedValue: value, Salt: salt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.TransientMap = map[string][]byte{appraisalTransientKey: appraisalJSON}
+}
+
+func TestAppraisalStaysPrivate(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 1, "Tomoko")
+	publicState := stub.keys()
+	assetJSON := string(stub.State["asset1"])
+
+	withAppraisal(t, stub, 750, "salt")
+	err := contract.SetAssetAppraisal(stub.as(bankUser), "asset1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stub.PvtState[appraisalCollection(bankUser.mspID)]["asset1"] == nil {
+		t.Fatalf("appraisal was not stored in the collection of %s", bankUser.mspID)
+	}
+
+	// Nothing public is written, so only the owning org has to endorse the appraisal
+	if keys := stub.keys(); len(keys) != len(publicState) || string(stub.State["asset1"]) != assetJSON {
+		t.Fatalf("the appraisal changed the public state: %v", keys)
+	}
+	if stub.lastEvent != "" {
+		t.Fatalf("expected no event, got %s", stub.lastEvent)
+	}
+
+	appraisal, err := contract.ReadAssetAppraisal(stub.as(bankUser2), "asset1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if appraisal.AppraisedValue != 750 {
+		t.Fatalf("expected an appraised value of 750, got %d", appraisal.AppraisedValue)
+	}
+
+	// Any org can verify a claimed appraisal against the hash
+	withAppraisal(t, stub, 750, "salt")
+	verified, err := contract.VerifyAppraisal(stub.as(insuranceUser), "asset1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified {
+		t.Fatal("expected the correct appraisal to verify")
+	}
+
+	withAppraisal(t, stub, 751, "salt")
+	verified, err = contract.VerifyAppraisal(stub.as(insuranceUser), "asset1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified {
+		t.Fatal("expected a wrong appraisal not to verify")
+	}
+}
+
+func TestTransferToAnotherOrgRemovesAppraisal(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 1, "Tomoko")
+
+	withAppraisal(t, stub, 750, "salt")
+	err := contract.SetAssetAppraisal(stub.as(bankUser), "asset1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = contract.TransferAsset(stub.as(bankUser), "asset1", "Brad", insuranceUser.mspID, insuranceUser.id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stub.PvtState[appraisalCollection(bankUser.mspID)]["asset1"] != nil {
+		t.Fatal("appraisal was left in the previous owner's collection")
+	}
+
+	withAppraisal(t, stub, 750, "salt")
+	_, err = contract.VerifyAppraisal(stub.as(bankUser), "asset1")
+	expectCode(t, err, ErrCodeNotFound)
+
+	// The new owner appraises the asset in its own collection, where verification then looks
+	withAppraisal(t, stub, 900, "pepper")
+	err = contract.SetAssetAppraisal(stub.as(insuranceUser), "asset1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withAppraisal(t, stub, 900, "pepper")
+	verified, err := contract.VerifyAppraisal(stub.as(bankUser), "asset1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified {
+		t.Fatal("expected the new owner's appraisal to verify")
+	}
+}
+
+func TestSetAssetAppraisalValidatesTransientInput(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 1, "Tomoko")
+
+	stub.TransientMap = nil
+	expectCode(t, contract.SetAssetAppraisal(stub.as(bankUser), "asset1"), ErrCodeInvalidArgument)
+
+	withAppraisal(t, stub, 750, "")
+	expectCode(t, contract.SetAssetAppraisal(stub.as(bankUser), "asset1"), ErrCodeInvalidArgument)
+
+	withAppraisal(t, stub, 750, "salt")
+	expectForbidden(t, contract.SetAssetAppraisal(stub.as(insuranceAdmin), "asset1"))
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
@@ -14,17 +15,32 @@ type SmartContract struct {
 	contractapi.Contract
 }
 
+// assetDocType marks asset documents in the state database, so that rich queries can tell them apart
+// from history records and other JSON documents stored in the same namespace
+const assetDocType = "asset"
+
 // Asset describes the basic details of an asset
 type Asset struct {
+	DocType        string `json:"docType"`
 	ID             string `json:"ID"`
 	Color          string `json:"color"`
 	Size           int    `json:"size"`
 	Owner          string `json:"owner"`
 	AppraisedValue int    `json:"appraisedValue"`
+	OwnerMSP       string `json:"ownerMSP"`
+	OwnerIdentity  string `json:"ownerIdentity"`
 	CreatedAt      string `json:"createdAt"`
 	UpdatedAt      string `json:"updatedAt"`
 }
 
+// LedgerHistoryEntry describes one committed version of an asset as recorded by the ledger itself
+type LedgerHistoryEntry struct {
+	TxID      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+	IsDelete  bool   `json:"isDelete"`
+	Value     *Asset `json:"value,omitempty" metadata:"value,optional"`
+}
+
 // AssetHistory tracks the history of an asset
 type AssetHistory struct {
 	AssetID   string `json:"assetId"`
@@ -34,8 +50,119 @@ type AssetHistory struct {
 	Timestamp string `json:"timestamp"`
 }
 
-// InitLedger adds a base set of assets to the ledger
+// historyObjectType is the composite key object type under which history records are stored
+const historyObjectType = "history"
+
+// legacyHistoryPrefix is the key prefix used by history records written before the composite key layout
+const legacyHistoryPrefix = "HISTORY_"
+
+// txTimestamp returns the transaction timestamp chosen by the client in RFC3339 format.
+// Every endorsing peer sees the same value, unlike time.Now(), so write sets stay deterministic.
+func txTimestamp(ctx contractapi.TransactionContextInterface) (string, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC().Format(time.RFC3339), nil
+}
+
+// recordHistory stores a history entry for the given asset, stamped with the transaction timestamp
+func recordHistory(ctx contractapi.TransactionContextInterface, assetID string, action string, owner string) error {
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	history := AssetHistory{
+		AssetID:   assetID,
+		Action:    action,
+		Owner:     owner,
+		TxID:      ctx.GetStub().GetTxID(),
+		Timestamp: timestamp,
+	}
+	historyJSON, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+
+	historyKey, err := ctx.GetStub().CreateCompositeKey(historyObjectType, []string{assetID, history.TxID})
+	if err != nil {
+		return fmt.Errorf("failed to create history key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(historyKey, historyJSON)
+	if err != nil {
+		return fmt.Errorf("failed to record history for asset %s: %v", assetID, err)
+	}
+
+	return nil
+}
+
+// putAsset writes the asset to the world state together with its history record and owner index entry.
+// All asset writes go through here so that no mutation can skip the history or its event.
+// previous is the stored version being replaced, or nil when the asset is new.
+func putAsset(ctx contractapi.TransactionContextInterface, asset *Asset, previous *Asset, action string) error {
+	asset.DocType = assetDocType
+	assetJSON, err := json.Marshal(asset)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(asset.ID, assetJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put to world state. %v", err)
+	}
+
+	if previous == nil || previous.Owner != asset.Owner {
+		if previous != nil {
+			err = deleteOwnerIndex(ctx, previous.Owner, previous.ID)
+			if err != nil {
+				return err
+			}
+		}
+		err = putOwnerIndex(ctx, asset.Owner, asset.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = recordHistory(ctx, asset.ID, action, asset.Owner)
+	if err != nil {
+		return err
+	}
+
+	return emitAssetEvent(ctx, action, previous, asset)
+}
+
+// removeAsset deletes the asset from the world state and records the deletion in its history
+func removeAsset(ctx contractapi.TransactionContextInterface, asset *Asset) error {
+	err := ctx.GetStub().DelState(asset.ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete from world state. %v", err)
+	}
+
+	err = deleteOwnerIndex(ctx, asset.Owner, asset.ID)
+	if err != nil {
+		return err
+	}
+
+	err = recordHistory(ctx, asset.ID, "DELETE", asset.Owner)
+	if err != nil {
+		return err
+	}
+
+	return emitAssetEvent(ctx, "DELETE", asset, nil)
+}
+
+// InitLedger adds a base set of assets to the ledger. Only an org admin may run it, and assets that
+// already exist are left as they are.
 func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
+	err := requireOrgAdmin(ctx, "InitLedger")
+	if err != nil {
+		return err
+	}
+
 	assets := []Asset{
 		{ID: "asset1", Color: "blue", Size: 5, Owner: "Tomoko", AppraisedValue: 300},
 		{ID: "asset2", Color: "red", Size: 5, Owner: "Brad", AppraisedValue: 400},
@@ -49,30 +176,40 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 		{ID: "asset10", Color: "brown", Size: 25, Owner: "Karim", AppraisedValue: 1200},
 	}
 
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	mspID, clientID, err := submittingClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	var assetIDs []string
 	for _, asset := range assets {
-		assetJSON, err := json.Marshal(asset)
+		exists, err := s.AssetExists(ctx, asset.ID)
 		if err != nil {
 			return err
 		}
-
-		err = ctx.GetStub().PutState(asset.ID, assetJSON)
-		if err != nil {
-			return fmt.Errorf("failed to put to world state. %v", err)
+		if exists {
+			continue
 		}
 
-		// Record creation history
-		history := AssetHistory{
-			AssetID:   asset.ID,
-			Action:    "CREATE",
-			Owner:     asset.Owner,
-			TxID:      ctx.GetStub().GetTxID(),
-			Timestamp: time.Now().Format(time.RFC3339),
+		asset.OwnerMSP = mspID
+		asset.OwnerIdentity = clientID
+		asset.CreatedAt = timestamp
+		asset.UpdatedAt = timestamp
+
+		err = putAsset(ctx, &asset, nil, "CREATE")
+		if err != nil {
+			return err
 		}
-		historyJSON, _ := json.Marshal(history)
-		ctx.GetStub().PutState(fmt.Sprintf("HISTORY_%s_%s", asset.ID, ctx.GetStub().GetTxID()), historyJSON)
+		assetIDs = append(assetIDs, asset.ID)
 	}
 
-	return nil
+	// Replaces the AssetCreated event of the last asset, as a transaction carries only one event
+	return setEvent(ctx, AssetEvent{Name: EventLedgerInitialized, AssetIDs: assetIDs})
 }
 
 // CreateAsset issues a new asset to the world state with given details
@@ -82,7 +219,18 @@ func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface,
 		return err
 	}
 	if exists {
-		return fmt.Errorf("the asset %s already exists", id)
+		return newError(ErrCodeAlreadyExists, "the asset %s already exists", id)
+	}
+
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The creator's identity owns the asset and is the only one, besides its org admins, allowed to change it
+	mspID, clientID, err := submittingClient(ctx)
+	if err != nil {
+		return err
 	}
 
 	asset := Asset{
@@ -91,15 +239,13 @@ func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface,
 		Size:           size,
 		Owner:          owner,
 		AppraisedValue: appraisedValue,
-		CreatedAt:      time.Now().Format(time.RFC3339),
-		UpdatedAt:      time.Now().Format(time.RFC3339),
-	}
-	assetJSON, err := json.Marshal(asset)
-	if err != nil {
-		return err
+		OwnerMSP:       mspID,
+		OwnerIdentity:  clientID,
+		CreatedAt:      timestamp,
+		UpdatedAt:      timestamp,
 	}
 
-	return ctx.GetStub().PutState(id, assetJSON)
+	return putAsset(ctx, &asset, nil, "CREATE")
 }
 
 // ReadAsset returns the asset stored in the world state with given id
@@ -109,7 +255,7 @@ func (s *SmartContract) ReadAsset(ctx contractapi.TransactionContextInterface, i
 		return nil, fmt.Errorf("failed to read from world state: %v", err)
 	}
 	if assetJSON == nil {
-		return nil, fmt.Errorf("the asset %s does not exist", id)
+		return nil, newError(ErrCodeNotFound, "the asset %s does not exist", id)
 	}
 
 	var asset Asset
@@ -121,14 +267,15 @@ func (s *SmartContract) ReadAsset(ctx contractapi.TransactionContextInterface, i
 	return &asset, nil
 }
 
-// UpdateAsset updates an existing asset in the world state with provided parameters
-func (s *SmartContract) UpdateAsset(ctx contractapi.TransactionContextInterface, id string, color string, size int, owner string, appraisedValue int) error {
+// UpdateAsset updates an existing asset in the world state with provided parameters.
+// The owner is kept, as ownership changes only through TransferAsset.
+func (s *SmartContract) UpdateAsset(ctx contractapi.TransactionContextInterface, id string, color string, size int, appraisedValue int) error {
 	exists, err := s.AssetExists(ctx, id)
 	if err != nil {
 		return err
 	}
 	if !exists {
-		return fmt.Errorf("the asset %s does not exist", id)
+		return newError(ErrCodeNotFound, "the asset %s does not exist", id)
 	}
 
 	// Get existing asset to record history
@@ -137,51 +284,50 @@ func (s *SmartContract) UpdateAsset(ctx contractapi.TransactionContextInterface,
 		return err
 	}
 
+	err = authorizeAssetChange(ctx, existingAsset)
+	if err != nil {
+		return err
+	}
+
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Overwrite the original asset with the new asset
 	asset := Asset{
 		ID:             id,
 		Color:          color,
 		Size:           size,
-		Owner:          owner,
+		Owner:          existingAsset.Owner,
 		AppraisedValue: appraisedValue,
+		OwnerMSP:       existingAsset.OwnerMSP,
+		OwnerIdentity:  existingAsset.OwnerIdentity,
 		CreatedAt:      existingAsset.CreatedAt, // Preserve original creation time
-		UpdatedAt:      time.Now().Format(time.RFC3339),
+		UpdatedAt:      timestamp,
 	}
-	assetJSON, err := json.Marshal(asset)
+
+	return putAsset(ctx, &asset, existingAsset, "UPDATE")
+}
+
+// DeleteAsset deletes an given asset from the world state
+func (s *SmartContract) DeleteAsset(ctx contractapi.TransactionContextInterface, id string) error {
+	asset, err := s.ReadAsset(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(id, assetJSON)
+	err = authorizeAssetChange(ctx, asset)
 	if err != nil {
 		return err
 	}
 
-	// Record update history
-	history := AssetHistory{
-		AssetID:   id,
-		Action:    "UPDATE",
-		Owner:     owner,
-		TxID:      ctx.GetStub().GetTxID(),
-		Timestamp: time.Now().Format(time.RFC3339),
-	}
-	historyJSON, _ := json.Marshal(history)
-	ctx.GetStub().PutState(fmt.Sprintf("HISTORY_%s_%s", id, ctx.GetStub().GetTxID()), historyJSON)
-
-	return nil
-}
-
-// DeleteAsset deletes an given asset from the world state
-func (s *SmartContract) DeleteAsset(ctx contractapi.TransactionContextInterface, id string) error {
-	exists, err := s.AssetExists(ctx, id)
+	err = deleteAppraisal(ctx, asset)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the asset %s does not exist", id)
-	}
 
-	return ctx.GetStub().DelState(id)
+	return removeAsset(ctx, asset)
 }
 
 // AssetExists returns true when asset with given ID exists in world state
@@ -194,38 +340,45 @@ func (s *SmartContract) AssetExists(ctx contractapi.TransactionContextInterface,
 	return assetJSON != nil, nil
 }
 
-// TransferAsset updates the owner field of asset with given id in world state
-func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterface, id string, newOwner string) error {
+// TransferAsset hands the asset with given id over to a new owner. newOwnerMSP and newOwnerIdentity
+// identify the client that controls the asset after the transfer.
+func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterface, id string, newOwner string, newOwnerMSP string, newOwnerIdentity string) error {
+	if newOwner == "" || newOwnerMSP == "" || newOwnerIdentity == "" {
+		return newError(ErrCodeInvalidArgument, "the new owner, owner MSP and owner identity of asset %s must not be empty", id)
+	}
+
 	asset, err := s.ReadAsset(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	asset.Owner = newOwner
-	asset.UpdatedAt = time.Now().Format(time.RFC3339)
-
-	assetJSON, err := json.Marshal(asset)
+	err = authorizeAssetChange(ctx, asset)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(id, assetJSON)
+	timestamp, err := txTimestamp(ctx)
 	if err != nil {
 		return err
 	}
 
-	// Record transfer history
-	history := AssetHistory{
-		AssetID:   id,
-		Action:    "TRANSFER",
-		Owner:     newOwner,
-		TxID:      ctx.GetStub().GetTxID(),
-		Timestamp: time.Now().Format(time.RFC3339),
+	previous := *asset
+
+	// The appraisal stays behind in the previous owner's collection, which the new owner cannot read
+	// or verify against, so it is removed
+	if newOwnerMSP != asset.OwnerMSP {
+		err = deleteAppraisal(ctx, asset)
+		if err != nil {
+			return err
+		}
 	}
-	historyJSON, _ := json.Marshal(history)
-	ctx.GetStub().PutState(fmt.Sprintf("HISTORY_%s_%s", id, ctx.GetStub().GetTxID()), historyJSON)
 
-	return nil
+	asset.Owner = newOwner
+	asset.OwnerMSP = newOwnerMSP
+	asset.OwnerIdentity = newOwnerIdentity
+	asset.UpdatedAt = timestamp
+
+	return putAsset(ctx, asset, &previous, "TRANSFER")
 }
 
 // GetAllAssets returns all assets found in world state
@@ -244,6 +397,11 @@ func (s *SmartContract) GetAllAssets(ctx contractapi.TransactionContextInterface
 			return nil, err
 		}
 
+		// Skip legacy history records that have not been migrated yet
+		if strings.HasPrefix(queryResponse.Key, legacyHistoryPrefix) {
+			continue
+		}
+
 		var asset Asset
 		err = json.Unmarshal(queryResponse.Value, &asset)
 		if err != nil {
@@ -257,7 +415,7 @@ func (s *SmartContract) GetAllAssets(ctx contractapi.TransactionContextInterface
 
 // GetAssetsByOwner returns all assets owned by a specific owner
 func (s *SmartContract) GetAssetsByOwner(ctx contractapi.TransactionContextInterface, owner string) ([]*Asset, error) {
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(ownerIndexName, []string{owner})
 	if err != nil {
 		return nil, err
 	}
@@ -270,15 +428,16 @@ func (s *SmartContract) GetAssetsByOwner(ctx contractapi.TransactionContextInter
 			return nil, err
 		}
 
-		var asset Asset
-		err = json.Unmarshal(queryResponse.Value, &asset)
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
 		if err != nil {
-			continue // Skip non-asset records
+			return nil, err
 		}
 
-		if asset.Owner == owner {
-			assets = append(assets, &asset)
+		asset, err := s.ReadAsset(ctx, attributes[1])
+		if err != nil {
+			return nil, err
 		}
+		assets = append(assets, asset)
 	}
 
 	return assets, nil
@@ -286,7 +445,7 @@ func (s *SmartContract) GetAssetsByOwner(ctx contractapi.TransactionContextInter
 
 // GetAssetHistory returns the history of changes for a specific asset
 func (s *SmartContract) GetAssetHistory(ctx contractapi.TransactionContextInterface, assetID string) ([]AssetHistory, error) {
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(historyObjectType, []string{assetID})
 	if err != nil {
 		return nil, err
 	}
@@ -299,24 +458,104 @@ func (s *SmartContract) GetAssetHistory(ctx contractapi.TransactionContextInterf
 			return nil, err
 		}
 
-		// Check if this is a history record for the requested asset
-		key := queryResponse.Key
-		if len(key) > 8 && key[:8] == "HISTORY_" {
-			var hist AssetHistory
-			err = json.Unmarshal(queryResponse.Value, &hist)
-			if err != nil {
-				continue
-			}
+		var hist AssetHistory
+		err = json.Unmarshal(queryResponse.Value, &hist)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, hist)
+	}
+
+	return history, nil
+}
+
+// GetAssetLedgerHistory returns every committed version of an asset from the ledger's history database.
+// Unlike GetAssetHistory it cannot miss a change, since the peer records each write and delete itself.
+func (s *SmartContract) GetAssetLedgerHistory(ctx contractapi.TransactionContextInterface, assetID string) ([]LedgerHistoryEntry, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(assetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ledger history: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var history []LedgerHistoryEntry
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		entry := LedgerHistoryEntry{
+			TxID:     modification.TxId,
+			IsDelete: modification.IsDelete,
+		}
+		if modification.Timestamp != nil {
+			entry.Timestamp = time.Unix(modification.Timestamp.Seconds, int64(modification.Timestamp.Nanos)).UTC().Format(time.RFC3339)
+		}
 
-			if hist.AssetID == assetID {
-				history = append(history, hist)
+		// Deleted versions carry no value
+		if !modification.IsDelete && len(modification.Value) > 0 {
+			var asset Asset
+			err = json.Unmarshal(modification.Value, &asset)
+			if err != nil {
+				return nil, err
 			}
+			entry.Value = &asset
 		}
+		history = append(history, entry)
 	}
 
 	return history, nil
 }
 
+// MigrateHistoryKeys moves history records stored under legacy HISTORY_ keys into the
+// composite key layout and returns the number of records migrated. Only an org admin may run it.
+func (s *SmartContract) MigrateHistoryKeys(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := requireOrgAdmin(ctx, "MigrateHistoryKeys")
+	if err != nil {
+		return 0, err
+	}
+
+	// '`' is the character after '_', so this range covers exactly the HISTORY_ keys
+	resultsIterator, err := ctx.GetStub().GetStateByRange(legacyHistoryPrefix, "HISTORY`")
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	migrated := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		var hist AssetHistory
+		err = json.Unmarshal(queryResponse.Value, &hist)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse history record %s: %v", queryResponse.Key, err)
+		}
+
+		historyKey, err := ctx.GetStub().CreateCompositeKey(historyObjectType, []string{hist.AssetID, hist.TxID})
+		if err != nil {
+			return 0, fmt.Errorf("failed to create history key: %v", err)
+		}
+
+		err = ctx.GetStub().PutState(historyKey, queryResponse.Value)
+		if err != nil {
+			return 0, fmt.Errorf("failed to migrate history record %s: %v", queryResponse.Key, err)
+		}
+
+		err = ctx.GetStub().DelState(queryResponse.Key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete legacy history record %s: %v", queryResponse.Key, err)
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
+
 // GetAssetCount returns the total number of assets in the ledger
 func (s *SmartContract) GetAssetCount(ctx contractapi.TransactionContextInterface) (int, error) {
 	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
@@ -332,9 +571,9 @@ func (s *SmartContract) GetAssetCount(ctx contractapi.TransactionContextInterfac
 			return 0, err
 		}
 
-		// Skip history records and only count assets
+		// Skip legacy history records that have not been migrated yet and only count assets
 		key := queryResponse.Key
-		if len(key) < 8 || key[:8] != "HISTORY_" {
+		if !strings.HasPrefix(key, legacyHistoryPrefix) {
 			var asset Asset
 			err = json.Unmarshal(queryResponse.Value, &asset)
 			if err == nil {
@@ -346,8 +585,15 @@ func (s *SmartContract) GetAssetCount(ctx contractapi.TransactionContextInterfac
 	return count, nil
 }
 
+// Ping reports that the chaincode is deployed and running on the peer without reading the ledger
+func (s *SmartContract) Ping(ctx contractapi.TransactionContextInterface) (string, error) {
+	return "pong", nil
+}
+
 func main() {
-	chaincode, err := contractapi.NewChaincode(&SmartContract{})
+	chaincode, err := contractapi.NewChaincode(&SmartContract{
+		Contract: contractapi.Contract{BeforeTransaction: logTraceContext},
+	})
 	if err != nil {
 		log.Panicf("Error creating chaincode: %v", err)
 	}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+)
+
+// legacyHistory writes a history record under the key layout used before composite keys
+func legacyHistory(t *testing.T, stub *fakeStub, hist AssetHistory) {
+	t.Helper()
+	putJSON(t, stub, legacyHistoryPrefix+hist.AssetID+"_"+hist.TxID, hist)
+}
+
+func TestMigrateHistoryKeys(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+
+	legacyHistory(t, stub, AssetHistory{AssetID: "asset1", Action: "CREATE", Owner: "Tomoko", TxID: "legacy1"})
+	legacyHistory(t, stub, AssetHistory{AssetID: "asset1", Action: "TRANSFER", Owner: "Brad", TxID: "legacy2"})
+	legacyHistory(t, stub, AssetHistory{AssetID: "asset2", Action: "CREATE", Owner: "Jin Soo", TxID: "legacy3"})
+
+	err := contract.CreateAsset(stub.as(bankUser), "asset3", "blue", 5, "Max", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = contract.MigrateHistoryKeys(stub.as(bankUser))
+	expectCode(t, err, ErrCodeForbidden)
+
+	migrated, err := contract.MigrateHistoryKeys(stub.as(bankAdmin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != 3 {
+		t.Fatalf("expected 3 migrated records, got %d", migrated)
+	}
+	if keys := stub.rangeKeys(legacyHistoryPrefix, ""); len(keys) != 1 || keys[0] != "asset3" {
+		t.Fatalf("expected only asset3 left under simple keys, got %q", keys)
+	}
+
+	history, err := contract.GetAssetHistory(stub.as(bankUser), "asset1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].TxID != "legacy1" || history[1].Owner != "Brad" {
+		t.Fatalf("unexpected history of asset1: %+v", history)
+	}
+
+	// A second run finds nothing left to migrate
+	migrated, err = contract.MigrateHistoryKeys(stub.as(bankAdmin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != 0 {
+		t.Fatalf("expected no records on the second run, got %d", migrated)
+	}
+}
+
+func TestGetAllAssetsSkipsLegacyHistory(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+
+	legacyHistory(t, stub, AssetHistory{AssetID: "asset1", Action: "CREATE", Owner: "Tomoko", TxID: "legacy1"})
+	err := contract.CreateAsset(stub.as(bankUser), "asset1", "blue", 5, "Tomoko", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assets, err := contract.GetAllAssets(stub.as(bankUser))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assets) != 1 || assets[0].ID != "asset1" {
+		t.Fatalf("expected only asset1, got %+v", assets)
+	}
+
+	page, err := contract.GetAllAssetsWithPagination(stub.as(bankUser), 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) != 1 || page.Records[0].ID != "asset1" || page.FetchedCount != 1 {
+		t.Fatalf("expected a page with only asset1 and a fetched count of 1, got %d records and a count of %d",
+			len(page.Records), page.FetchedCount)
+	}
+
+	count, err := contract.GetAssetCount(stub.as(bankUser))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expected an asset count of 1, got %d", count)
+	}
+}
+
+func TestGetAssetLedgerHistory(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 1, "Tomoko")
+
+	err := contract.UpdateAsset(stub.as(bankUser), "asset1", "red", 7, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = contract.TransferAsset(stub.as(bankUser), "asset1", "Brad", insuranceUser.mspID, insuranceUser.id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = contract.DeleteAsset(stub.as(insuranceUser), "asset1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := contract.GetAssetLedgerHistory(stub.as(bankUser), "asset1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 4 {
+		t.Fatalf("expected 4 versions of asset1, got %+v", history)
+	}
+
+	// Newest first: the delete carries no value, every write the asset as it was committed
+	if !history[0].IsDelete || history[0].Value != nil || history[0].TxID != "tx4" {
+		t.Fatalf("expected the delete of tx4 first, got %+v", history[0])
+	}
+	expected := []struct {
+		txID, color, owner string
+	}{
+		{"tx3", "red", "Brad"},
+		{"tx2", "red", "Tomoko"},
+		{"tx1", "blue", "Tomoko"},
+	}
+	for i, want := range expected {
+		entry := history[i+1]
+		if entry.IsDelete || entry.Value == nil || entry.TxID != want.txID || entry.Value.Color != want.color || entry.Value.Owner != want.owner {
+			t.Fatalf("version %d: expected %s with a %s asset of %s, got %+v", i+1, want.txID, want.color, want.owner, entry)
+		}
+		if entry.Timestamp == "" {
+			t.Fatalf("version %d has no timestamp", i+1)
+		}
+	}
+
+	// Keys that were never written have no history
+	history, err = contract.GetAssetLedgerHistory(stub.as(bankUser), "asset2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 0 {
+		t.Fatalf("expected no history for asset2, got %+v", history)
+	}
+}
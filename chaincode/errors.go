@@ -0,0 +1,27 @@
+package main
+
+import "fmt"
+
+// Error codes that prefix chaincode error messages as "[CODE] message", so that clients can tell the
+// reason of a failed transaction apart without parsing the message itself
+const (
+	ErrCodeNotFound        = "NOT_FOUND"
+	ErrCodeAlreadyExists   = "ALREADY_EXISTS"
+	ErrCodeForbidden       = "FORBIDDEN"
+	ErrCodeInvalidArgument = "INVALID_ARGUMENT"
+)
+
+// ChaincodeError is an error carrying one of the error codes above
+type ChaincodeError struct {
+	Code    string
+	Message string
+}
+
+func (e *ChaincodeError) Error() string {
+	return fmt.Sprintf("[%s] %s", e.Code, e.Message)
+}
+
+// newError returns a ChaincodeError with the given code and formatted message
+func newError(code string, format string, args ...interface{}) error {
+	return &ChaincodeError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// AssetEventVersion is the version of the AssetEvent payload schema. It is raised whenever a field
+// is removed or changes meaning; new optional fields may be added without raising it.
+const AssetEventVersion = 1
+
+// Names of the chaincode events emitted on asset state changes
+const (
+	EventAssetCreated      = "AssetCreated"
+	EventAssetUpdated      = "AssetUpdated"
+	EventAssetTransferred  = "AssetTransferred"
+	EventAssetDeleted      = "AssetDeleted"
+	EventLedgerInitialized = "LedgerInitialized"
+)
+
+// actionEvents maps history actions to the event emitted for them
+var actionEvents = map[string]string{
+	"CREATE":   EventAssetCreated,
+	"UPDATE":   EventAssetUpdated,
+	"TRANSFER": EventAssetTransferred,
+	"DELETE":   EventAssetDeleted,
+}
+
+// AssetEvent is the JSON payload of every asset chaincode event
+type AssetEvent struct {
+	Version       int      `json:"version"`
+	Name          string   `json:"name"`
+	TxID          string   `json:"txId"`
+	Timestamp     string   `json:"timestamp"`
+	AssetID       string   `json:"assetId,omitempty"`
+	PreviousOwner string   `json:"previousOwner,omitempty"`
+	Owner         string   `json:"owner,omitempty"`
+	Asset         *Asset   `json:"asset,omitempty"`
+	AssetIDs      []string `json:"assetIds,omitempty"`
+}
+
+// setEvent emits the event on the transaction.
+// Fabric keeps only the last event set by a transaction, so each function emits exactly one.
+func setEvent(ctx contractapi.TransactionContextInterface, event AssetEvent) error {
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	event.Version = AssetEventVersion
+	event.TxID = ctx.GetStub().GetTxID()
+	event.Timestamp = timestamp
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent(event.Name, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event %s: %v", event.Name, err)
+	}
+
+	return nil
+}
+
+// emitAssetEvent emits the event for an asset change. previous is nil for new assets and
+// current is nil for deleted ones.
+func emitAssetEvent(ctx contractapi.TransactionContextInterface, action string, previous *Asset, current *Asset) error {
+	name, ok := actionEvents[action]
+	if !ok {
+		return fmt.Errorf("no event is defined for action %s", action)
+	}
+
+	event := AssetEvent{Name: name, Asset: current}
+	if previous != nil {
+		event.AssetID = previous.ID
+		event.PreviousOwner = previous.Owner
+	}
+	if current != nil {
+		event.AssetID = current.ID
+		event.Owner = current.Owner
+	}
+
+	return setEvent(ctx, event)
+}
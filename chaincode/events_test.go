@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCreateAssetEmitsEvent(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+
+	err := contract.CreateAsset(stub.as(bankUser), "asset1", "blue", 5, "Tomoko", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := expectEvent(t, stub, EventAssetCreated)
+	if event.AssetID != "asset1" || event.Owner != "Tomoko" || event.PreviousOwner != "" {
+		t.Fatalf("unexpected create event: %+v", event)
+	}
+	if event.Asset == nil || event.Asset.OwnerMSP != bankUser.mspID || event.Asset.AppraisedValue != 300 {
+		t.Fatalf("expected the created asset in the event, got %+v", event.Asset)
+	}
+
+	expectedTimestamp := time.Unix(stub.TxTimestamp.Seconds, int64(stub.TxTimestamp.Nanos)).UTC().Format(time.RFC3339)
+	if event.Timestamp != expectedTimestamp {
+		t.Fatalf("expected the transaction timestamp %s, got %s", expectedTimestamp, event.Timestamp)
+	}
+}
+
+func TestAssetEventPayloadFields(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 1, "Tomoko")
+
+	err := contract.TransferAsset(stub.as(bankUser), "asset1", "Brad", insuranceUser.mspID, insuranceUser.id())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Consumers depend on these names; renaming one requires raising AssetEventVersion
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(stub.lastEventPayload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	var fields []string
+	for field := range payload {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	expected := []string{"asset", "assetId", "name", "owner", "previousOwner", "timestamp", "txId", "version"}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("expected payload fields %v, got %v", expected, fields)
+	}
+}
+
+func TestEmitAssetEventRejectsUnknownAction(t *testing.T) {
+	stub := newFakeStub()
+
+	err := emitAssetEvent(stub.as(bankUser), "APPRAISE", nil, &Asset{ID: "asset1"})
+	if err == nil {
+		t.Fatal("expected an error for an action without an event")
+	}
+	if stub.lastEvent != "" {
+		t.Fatalf("expected no event, got %s", stub.lastEvent)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ownerIndexName is the composite key object type of the owner secondary index.
+// Index entries are keyed by owner and asset ID and carry no value of their own.
+const ownerIndexName = "owner~assetID"
+
+// ownerIndexValue is stored under each index key, since the world state cannot hold empty values
+var ownerIndexValue = []byte{0x00}
+
+// putOwnerIndex adds the asset to the owner index
+func putOwnerIndex(ctx contractapi.TransactionContextInterface, owner string, assetID string) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey(ownerIndexName, []string{owner, assetID})
+	if err != nil {
+		return fmt.Errorf("failed to create owner index key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(indexKey, ownerIndexValue)
+	if err != nil {
+		return fmt.Errorf("failed to put owner index entry for asset %s: %v", assetID, err)
+	}
+
+	return nil
+}
+
+// deleteOwnerIndex removes the asset from the owner index
+func deleteOwnerIndex(ctx contractapi.TransactionContextInterface, owner string, assetID string) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey(ownerIndexName, []string{owner, assetID})
+	if err != nil {
+		return fmt.Errorf("failed to create owner index key: %v", err)
+	}
+
+	err = ctx.GetStub().DelState(indexKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete owner index entry for asset %s: %v", assetID, err)
+	}
+
+	return nil
+}
+
+// RebuildOwnerIndex drops every owner index entry and recreates the index from the assets in
+// world state. It returns the number of assets indexed. Only an org admin may run it.
+func (s *SmartContract) RebuildOwnerIndex(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := requireOrgAdmin(ctx, "RebuildOwnerIndex")
+	if err != nil {
+		return 0, err
+	}
+
+	indexIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(ownerIndexName, []string{})
+	if err != nil {
+		return 0, err
+	}
+	defer indexIterator.Close()
+
+	for indexIterator.HasNext() {
+		queryResponse, err := indexIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		err = ctx.GetStub().DelState(queryResponse.Key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete owner index entry: %v", err)
+		}
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	indexed := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		// Skip legacy history records that have not been migrated yet
+		if strings.HasPrefix(queryResponse.Key, legacyHistoryPrefix) {
+			continue
+		}
+
+		var asset Asset
+		err = json.Unmarshal(queryResponse.Value, &asset)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse asset %s: %v", queryResponse.Key, err)
+		}
+
+		err = putOwnerIndex(ctx, asset.Owner, asset.ID)
+		if err != nil {
+			return 0, err
+		}
+		indexed++
+	}
+
+	return indexed, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// checkOwnerIndex fails the test unless every asset has exactly one owner index entry, under its current owner
+func checkOwnerIndex(t *testing.T, stub *fakeStub) {
+	t.Helper()
+
+	indexed := map[string]string{}
+	keys, err := stub.compositeKeys(ownerIndexName, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		_, attributes, err := stub.SplitCompositeKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		owner, assetID := attributes[0], attributes[1]
+		if previous, ok := indexed[assetID]; ok {
+			t.Fatalf("asset %s is indexed under both %s and %s", assetID, previous, owner)
+		}
+		indexed[assetID] = owner
+	}
+
+	for _, key := range stub.rangeKeys("", "") {
+		var asset Asset
+		err := json.Unmarshal(stub.State[key], &asset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if indexed[asset.ID] != asset.Owner {
+			t.Fatalf("asset %s of %s is indexed under %q", asset.ID, asset.Owner, indexed[asset.ID])
+		}
+		delete(indexed, asset.ID)
+	}
+	if len(indexed) != 0 {
+		t.Fatalf("owner index has entries for missing assets: %v", indexed)
+	}
+}
+
+func TestInitLedgerAgainKeepsOwnerIndex(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+
+	err := contract.InitLedger(stub.as(bankAdmin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = contract.TransferAsset(stub.as(bankAdmin), "asset1", "Brad", insuranceUser.mspID, insuranceUser.id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOwnerIndex(t, stub)
+
+	err = contract.InitLedger(stub.as(bankAdmin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOwnerIndex(t, stub)
+}
+
+func TestRebuildOwnerIndex(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+
+	err := contract.InitLedger(stub.as(bankAdmin))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop an entry, as an asset written before the index existed would lack one
+	key, err := stub.CreateCompositeKey(ownerIndexName, []string{"Tomoko", "asset1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stub.DelState(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = contract.RebuildOwnerIndex(stub.as(bankUser))
+	expectCode(t, err, ErrCodeForbidden)
+	if stub.State[key] != nil {
+		t.Fatal("a rejected rebuild restored the index entry")
+	}
+
+	indexed, err := contract.RebuildOwnerIndex(stub.as(bankAdmin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexed != 10 {
+		t.Fatalf("expected 10 indexed assets, got %d", indexed)
+	}
+	if !bytes.Equal(stub.State[key], ownerIndexValue) {
+		t.Fatalf("expected the index entry of asset1 to be restored, got %v", stub.State[key])
+	}
+	checkOwnerIndex(t, stub)
+
+	assets, err := contract.GetAssetsByOwner(stub.as(bankUser), "Tomoko")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assets) != 1 || assets[0].ID != "asset1" {
+		t.Fatalf("expected asset1 to be found by its owner, got %+v", assets)
+	}
+}
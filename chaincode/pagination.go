@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// PaginatedAssets is a single page of assets together with the bookmark for the next page
+type PaginatedAssets struct {
+	Records      []*Asset `json:"records"`
+	FetchedCount int32    `json:"fetchedCount"`
+	Bookmark     string   `json:"bookmark"`
+}
+
+// PaginatedHistory is a single page of history records together with the bookmark for the next page
+type PaginatedHistory struct {
+	Records      []AssetHistory `json:"records"`
+	FetchedCount int32          `json:"fetchedCount"`
+	Bookmark     string         `json:"bookmark"`
+}
+
+// GetAllAssetsWithPagination returns up to pageSize assets starting from the given bookmark.
+// Pass an empty bookmark to read the first page.
+func (s *SmartContract) GetAllAssetsWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*PaginatedAssets, error) {
+	resultsIterator, metadata, err := ctx.GetStub().GetStateByRangeWithPagination("", "", pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	assets, err := assetsFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	// The page's range also covers legacy history keys, which are scanned but not returned, so the
+	// peer's FetchedRecordsCount may be higher than the number of records
+	return &PaginatedAssets{
+		Records:      assets,
+		FetchedCount: int32(len(assets)),
+		Bookmark:     metadata.Bookmark,
+	}, nil
+}
+
+// GetAssetsByOwnerWithPagination returns up to pageSize assets of the given owner starting from the bookmark
+func (s *SmartContract) GetAssetsByOwnerWithPagination(ctx contractapi.TransactionContextInterface, owner string, pageSize int32, bookmark string) (*PaginatedAssets, error) {
+	resultsIterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(ownerIndexName, []string{owner}, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	assets := []*Asset{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		asset, err := s.ReadAsset(ctx, attributes[1])
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+
+	return &PaginatedAssets{
+		Records:      assets,
+		FetchedCount: metadata.FetchedRecordsCount,
+		Bookmark:     metadata.Bookmark,
+	}, nil
+}
+
+// GetAssetHistoryWithPagination returns up to pageSize history records of an asset starting from the bookmark
+func (s *SmartContract) GetAssetHistoryWithPagination(ctx contractapi.TransactionContextInterface, assetID string, pageSize int32, bookmark string) (*PaginatedHistory, error) {
+	resultsIterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(historyObjectType, []string{assetID}, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	history := []AssetHistory{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var hist AssetHistory
+		err = json.Unmarshal(queryResponse.Value, &hist)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, hist)
+	}
+
+	return &PaginatedHistory{
+		Records:      history,
+		FetchedCount: metadata.FetchedRecordsCount,
+		Bookmark:     metadata.Bookmark,
+	}, nil
+}
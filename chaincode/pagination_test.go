@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// createAssets creates assets asset1 to assetN, owned by the given owner name and the client
+func createAssets(t *testing.T, stub *fakeStub, client *fakeClient, n int, owner string) {
+	t.Helper()
+	contract := new(SmartContract)
+	for i := 1; i <= n; i++ {
+		err := contract.CreateAsset(stub.as(client), fmt.Sprintf("asset%d", i), "blue", i, owner, 100*i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetAllAssetsWithPagination(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 5, "Tomoko")
+	legacyHistory(t, stub, AssetHistory{AssetID: "asset1", Action: "CREATE", Owner: "Tomoko", TxID: "legacy1"})
+
+	var ids []string
+	bookmark := ""
+	for pages := 1; ; pages++ {
+		result, err := contract.GetAllAssetsWithPagination(stub.as(bankUser), 2, bookmark)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Records) > 2 {
+			t.Fatalf("page %d has %d records", pages, len(result.Records))
+		}
+		for _, asset := range result.Records {
+			ids = append(ids, asset.ID)
+		}
+		if result.Bookmark == "" {
+			break
+		}
+		if result.Bookmark == bookmark {
+			t.Fatalf("bookmark %q did not advance", bookmark)
+		}
+		bookmark = result.Bookmark
+	}
+
+	// Keys sort as strings, and the legacy history record is skipped
+	expected := []string{"asset1", "asset2", "asset3", "asset4", "asset5"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expected %v across all pages, got %v", expected, ids)
+	}
+}
+
+func TestGetAssetsByOwnerWithPagination(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 3, "Tomoko")
+	err := contract.CreateAsset(stub.as(bankUser), "asset9", "red", 1, "Brad", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := contract.GetAssetsByOwnerWithPagination(stub.as(bankUser), "Tomoko", 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.FetchedCount != 2 || len(first.Records) != 2 || first.Bookmark == "" {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+
+	second, err := contract.GetAssetsByOwnerWithPagination(stub.as(bankUser), "Tomoko", 2, first.Bookmark)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.FetchedCount != 1 || len(second.Records) != 1 || second.Bookmark != "" {
+		t.Fatalf("unexpected last page: %+v", second)
+	}
+	if second.Records[0].Owner != "Tomoko" || second.Records[0].ID != "asset3" {
+		t.Fatalf("unexpected asset on the last page: %+v", second.Records[0])
+	}
+}
+
+func TestGetAssetHistoryWithPagination(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 2, "Tomoko")
+	for _, owner := range []string{"Brad", "Max"} {
+		err := contract.TransferAsset(stub.as(bankUser), "asset1", owner, bankUser.mspID, bankUser.id())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var actions []string
+	bookmark := ""
+	for {
+		result, err := contract.GetAssetHistoryWithPagination(stub.as(bankUser), "asset1", 2, bookmark)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, hist := range result.Records {
+			if hist.AssetID != "asset1" {
+				t.Fatalf("history of asset1 returned a record of %s", hist.AssetID)
+			}
+			actions = append(actions, hist.Action)
+		}
+		if result.Bookmark == "" {
+			break
+		}
+		bookmark = result.Bookmark
+	}
+
+	if len(actions) != 3 {
+		t.Fatalf("expected 3 history records of asset1, got %v", actions)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Rich queries require CouchDB as the state database. The indexes they rely on are
+// packaged with the chaincode under META-INF/statedb/couchdb/indexes.
+
+// QueryAssets returns the assets matching a CouchDB selector query string,
+// e.g. {"selector":{"color":"blue"}}
+func (s *SmartContract) QueryAssets(ctx contractapi.TransactionContextInterface, queryString string) ([]*Asset, error) {
+	queryString, err := assetQuery(queryString)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run rich query: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	return assetsFromIterator(resultsIterator)
+}
+
+// QueryAssetsWithPagination returns up to pageSize assets matching a CouchDB selector query string,
+// starting from the given bookmark
+func (s *SmartContract) QueryAssetsWithPagination(ctx contractapi.TransactionContextInterface, queryString string, pageSize int32, bookmark string) (*PaginatedAssets, error) {
+	queryString, err := assetQuery(queryString)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetQueryResultWithPagination(queryString, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run rich query: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	assets, err := assetsFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedAssets{
+		Records:      assets,
+		FetchedCount: metadata.FetchedRecordsCount,
+		Bookmark:     metadata.Bookmark,
+	}, nil
+}
+
+// QueryAssetsByColor returns all assets of the given color
+func (s *SmartContract) QueryAssetsByColor(ctx contractapi.TransactionContextInterface, color string) ([]*Asset, error) {
+	queryString, err := selectorQuery(map[string]interface{}{"color": color})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.QueryAssets(ctx, queryString)
+}
+
+// QueryAssetsBySizeRange returns all assets whose size lies within [minSize, maxSize]
+func (s *SmartContract) QueryAssetsBySizeRange(ctx contractapi.TransactionContextInterface, minSize int, maxSize int) ([]*Asset, error) {
+	queryString, err := selectorQuery(map[string]interface{}{
+		"size": map[string]interface{}{"$gte": minSize, "$lte": maxSize},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.QueryAssets(ctx, queryString)
+}
+
+// QueryAssetsByAppraisedValueRange returns all assets whose public appraised value lies within [minValue, maxValue].
+// An appraised value of 0 means the owner published none, so those assets never match, whatever the range.
+func (s *SmartContract) QueryAssetsByAppraisedValueRange(ctx contractapi.TransactionContextInterface, minValue int, maxValue int) ([]*Asset, error) {
+	queryString, err := selectorQuery(map[string]interface{}{
+		"appraisedValue": map[string]interface{}{"$gte": minValue, "$lte": maxValue, "$gt": 0},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.QueryAssets(ctx, queryString)
+}
+
+// QueryAssetsByCreatedAtRange returns all assets created within [start, end].
+// Both bounds are RFC3339 timestamps, which compare correctly as strings.
+func (s *SmartContract) QueryAssetsByCreatedAtRange(ctx contractapi.TransactionContextInterface, start string, end string) ([]*Asset, error) {
+	queryString, err := selectorQuery(map[string]interface{}{
+		"createdAt": map[string]interface{}{"$gte": start, "$lte": end},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.QueryAssets(ctx, queryString)
+}
+
+// selectorQuery builds a CouchDB query string from a selector. Building it with json.Marshal
+// rather than string formatting keeps caller-supplied values from altering the query.
+func selectorQuery(selector map[string]interface{}) (string, error) {
+	queryJSON, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return "", fmt.Errorf("failed to build query: %v", err)
+	}
+
+	return string(queryJSON), nil
+}
+
+// MigrateAssetDocType sets the docType of assets written before it was recorded, so that rich queries
+// find them again. It returns the number of assets updated. Only an org admin may run it.
+func (s *SmartContract) MigrateAssetDocType(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := requireOrgAdmin(ctx, "MigrateAssetDocType")
+	if err != nil {
+		return 0, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	assets, err := assetsFromIterator(resultsIterator)
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, asset := range assets {
+		if asset.DocType == assetDocType {
+			continue
+		}
+
+		// Only the marker changes, so the asset gets no history record or event
+		asset.DocType = assetDocType
+		assetJSON, err := json.Marshal(asset)
+		if err != nil {
+			return 0, err
+		}
+		err = ctx.GetStub().PutState(asset.ID, assetJSON)
+		if err != nil {
+			return 0, fmt.Errorf("failed to put to world state. %v", err)
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+// assetQuery restricts the selector of a CouchDB query string to asset documents. History records are
+// JSON documents too and would otherwise match selectors on the fields they share with assets, such as owner.
+func assetQuery(queryString string) (string, error) {
+	var query map[string]interface{}
+	err := json.Unmarshal([]byte(queryString), &query)
+	if err != nil {
+		return "", newError(ErrCodeInvalidArgument, "failed to parse query: %v", err)
+	}
+
+	selector, ok := query["selector"].(map[string]interface{})
+	if !ok {
+		return "", newError(ErrCodeInvalidArgument, "the query must have a selector object")
+	}
+	query["selector"] = map[string]interface{}{
+		"$and": []interface{}{map[string]interface{}{"docType": assetDocType}, selector},
+	}
+
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return "", fmt.Errorf("failed to build query: %v", err)
+	}
+
+	return string(queryJSON), nil
+}
+
+// assetsFromIterator reads every asset from a query result iterator
+func assetsFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]*Asset, error) {
+	assets := []*Asset{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		// Skip legacy history records that have not been migrated yet, which a range over all keys returns
+		if strings.HasPrefix(queryResponse.Key, legacyHistoryPrefix) {
+			continue
+		}
+
+		var asset Asset
+		err = json.Unmarshal(queryResponse.Value, &asset)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, &asset)
+	}
+
+	return assets, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"testing"
+)
+
+// assetIDs returns the IDs of the assets in order
+func assetIDs(assets []*Asset) []string {
+	ids := []string{}
+	for _, asset := range assets {
+		ids = append(ids, asset.ID)
+	}
+	return ids
+}
+
+func TestQueryAssetsMatchesOnlyAssets(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 2, "Tomoko")
+
+	// Every asset write also stores a history record with an owner field
+	assets, err := contract.QueryAssets(stub.as(bankUser), `{"selector":{"owner":"Tomoko"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := assetIDs(assets); len(ids) != 2 || ids[0] != "asset1" || ids[1] != "asset2" {
+		t.Fatalf("expected asset1 and asset2, got %v", ids)
+	}
+
+	// A selector naming another docType still cannot reach the history records
+	assets, err = contract.QueryAssets(stub.as(bankUser), `{"selector":{"docType":"history","owner":"Tomoko"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assets) != 0 {
+		t.Fatalf("expected no assets, got %v", assetIDs(assets))
+	}
+}
+
+func TestQueryAssetsRejectsInvalidQueries(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+
+	for _, query := range []string{`not json`, `{"fields":["ID"]}`, `{"selector":"color"}`} {
+		_, err := contract.QueryAssets(stub.as(bankUser), query)
+		expectCode(t, err, ErrCodeInvalidArgument)
+	}
+}
+
+func TestTypedQueries(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 5, "Tomoko")
+	err := contract.CreateAsset(stub.as(bankUser), "asset9", "red", 3, "Brad", 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byColor, err := contract.QueryAssetsByColor(stub.as(bankUser), "red")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := assetIDs(byColor); len(ids) != 1 || ids[0] != "asset9" {
+		t.Fatalf("expected asset9 by color, got %v", ids)
+	}
+
+	bySize, err := contract.QueryAssetsBySizeRange(stub.as(bankUser), 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := assetIDs(bySize); len(ids) != 3 {
+		t.Fatalf("expected 3 assets of size 2 to 3, got %v", ids)
+	}
+
+	byValue, err := contract.QueryAssetsByAppraisedValueRange(stub.as(bankUser), 250, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := assetIDs(byValue); len(ids) != 3 {
+		t.Fatalf("expected 3 assets appraised at 250 to 400, got %v", ids)
+	}
+
+	// An asset without a published appraised value is not matched by a range that includes 0
+	err = contract.CreateAsset(stub.as(bankUser), "asset10", "red", 3, "Brad", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byValue, err = contract.QueryAssetsByAppraisedValueRange(stub.as(bankUser), 0, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := assetIDs(byValue); len(ids) != 2 || ids[0] != "asset1" || ids[1] != "asset2" {
+		t.Fatalf("expected asset1 and asset2 appraised at 0 to 200, got %v", ids)
+	}
+
+	byCreatedAt, err := contract.QueryAssetsByCreatedAtRange(stub.as(bankUser), "2000-01-01T00:00:00Z", "2999-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byCreatedAt) != 7 {
+		t.Fatalf("expected all 7 assets by creation time, got %v", assetIDs(byCreatedAt))
+	}
+}
+
+func TestQueryAssetsWithPagination(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 5, "Tomoko")
+
+	var ids []string
+	bookmark := ""
+	for {
+		result, err := contract.QueryAssetsWithPagination(stub.as(bankUser), `{"selector":{"owner":"Tomoko"}}`, 2, bookmark)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, assetIDs(result.Records)...)
+		if result.Bookmark == "" {
+			break
+		}
+		bookmark = result.Bookmark
+	}
+
+	if len(ids) != 5 {
+		t.Fatalf("expected 5 assets across all pages, got %v", ids)
+	}
+}
+
+func TestMigrateAssetDocType(t *testing.T) {
+	stub := newFakeStub()
+	contract := new(SmartContract)
+	createAssets(t, stub, bankUser, 1, "Tomoko")
+	putJSON(t, stub, "asset2", Asset{ID: "asset2", Color: "blue", Size: 5, Owner: "Tomoko"})
+
+	assets, err := contract.QueryAssetsByColor(stub.as(bankUser), "blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assets) != 1 {
+		t.Fatalf("expected only the asset with a docType, got %v", assetIDs(assets))
+	}
+
+	_, err = contract.MigrateAssetDocType(stub.as(bankUser))
+	expectCode(t, err, ErrCodeForbidden)
+
+	migrated, err := contract.MigrateAssetDocType(stub.as(bankAdmin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != 1 {
+		t.Fatalf("expected 1 migrated asset, got %d", migrated)
+	}
+
+	assets, err = contract.QueryAssetsByColor(stub.as(bankUser), "blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assets) != 2 {
+		t.Fatalf("expected both assets after the migration, got %v", assetIDs(assets))
+	}
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// fakeStub is an in-memory world state for tests. It builds on shimtest.MockStub and, like a peer,
+// keeps composite keys out of range queries over simple keys.
+type fakeStub struct {
+	*shimtest.MockStub
+	txCount   int
+	lastEvent string
+	// lastEventPayload is the payload of lastEvent; both are cleared when a transaction starts
+	lastEventPayload []byte
+	// modifications records every write and delete of a key, like the peer's history database
+	modifications map[string][]*queryresult.KeyModification
+}
+
+func newFakeStub() *fakeStub {
+	return &fakeStub{
+		MockStub:      shimtest.NewMockStub("asset", nil),
+		modifications: make(map[string][]*queryresult.KeyModification),
+	}
+}
+
+// fakeClient is the identity of the client submitting a test transaction
+type fakeClient struct {
+	mspID string
+	name  string
+	admin bool
+}
+
+var (
+	bankUser       = &fakeClient{mspID: "BankOrgMSP", name: "user1"}
+	bankUser2      = &fakeClient{mspID: "BankOrgMSP", name: "user2"}
+	bankAdmin      = &fakeClient{mspID: "BankOrgMSP", name: "Admin", admin: true}
+	insuranceUser  = &fakeClient{mspID: "InsuranceOrgMSP", name: "user1"}
+	insuranceAdmin = &fakeClient{mspID: "InsuranceOrgMSP", name: "Admin", admin: true}
+)
+
+// id returns the decoded X.509 identity of the client, as recorded in OwnerIdentity
+func (c *fakeClient) id() string {
+	return fmt.Sprintf("x509::CN=%s,OU=client::CN=ca.%s", c.name, c.mspID)
+}
+
+func (c *fakeClient) GetID() (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(c.id())), nil
+}
+
+func (c *fakeClient) GetMSPID() (string, error) {
+	return c.mspID, nil
+}
+
+func (c *fakeClient) GetAttributeValue(attrName string) (string, bool, error) {
+	return "", false, nil
+}
+
+func (c *fakeClient) AssertAttributeValue(attrName, attrValue string) error {
+	return fmt.Errorf("attribute %s not found", attrName)
+}
+
+func (c *fakeClient) GetX509Certificate() (*x509.Certificate, error) {
+	ou := "client"
+	if c.admin {
+		ou = adminOU
+	}
+	return &x509.Certificate{Subject: pkix.Name{CommonName: c.name, OrganizationalUnit: []string{ou}}}, nil
+}
+
+// as starts a new transaction submitted by the client and returns its context
+func (stub *fakeStub) as(client *fakeClient) contractapi.TransactionContextInterface {
+	stub.txCount++
+	stub.MockTransactionStart(fmt.Sprintf("tx%d", stub.txCount))
+	stub.lastEvent, stub.lastEventPayload = "", nil
+
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(client)
+	return ctx
+}
+
+func (stub *fakeStub) SetEvent(name string, payload []byte) error {
+	stub.lastEvent, stub.lastEventPayload = name, payload
+	return nil
+}
+
+func (stub *fakeStub) PutState(key string, value []byte) error {
+	if err := stub.MockStub.PutState(key, value); err != nil {
+		return err
+	}
+	stub.modifications[key] = append(stub.modifications[key], &queryresult.KeyModification{TxId: stub.TxID, Value: value, Timestamp: stub.TxTimestamp})
+	return nil
+}
+
+func (stub *fakeStub) DelState(key string) error {
+	if err := stub.MockStub.DelState(key); err != nil {
+		return err
+	}
+	stub.modifications[key] = append(stub.modifications[key], &queryresult.KeyModification{TxId: stub.TxID, Timestamp: stub.TxTimestamp, IsDelete: true})
+	return nil
+}
+
+// GetHistoryForKey returns the recorded modifications of the key, newest first like a Fabric 2.x peer
+func (stub *fakeStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	modifications := stub.modifications[key]
+	results := make([]*queryresult.KeyModification, 0, len(modifications))
+	for i := len(modifications) - 1; i >= 0; i-- {
+		results = append(results, modifications[i])
+	}
+	return &fakeHistoryIterator{results: results}, nil
+}
+
+// GetPrivateDataHash returns the hash every peer keeps of a private data value, even outside the collection
+func (stub *fakeStub) GetPrivateDataHash(collection, key string) ([]byte, error) {
+	value := stub.PvtState[collection][key]
+	if value == nil {
+		return nil, nil
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+func (stub *fakeStub) DelPrivateData(collection, key string) error {
+	delete(stub.PvtState[collection], key)
+	return nil
+}
+
+// keys returns the keys in world state in ascending order
+func (stub *fakeStub) keys() []string {
+	var keys []string
+	for elem := stub.Keys.Front(); elem != nil; elem = elem.Next() {
+		keys = append(keys, elem.Value.(string))
+	}
+	return keys
+}
+
+// rangeKeys returns the simple keys within [startKey, endKey). An empty endKey leaves the range open.
+func (stub *fakeStub) rangeKeys(startKey, endKey string) []string {
+	var keys []string
+	for _, key := range stub.keys() {
+		if strings.HasPrefix(key, "\x00") || key < startKey || (endKey != "" && key >= endKey) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// compositeKeys returns the composite keys starting with the partial key
+func (stub *fakeStub) compositeKeys(objectType string, attributes []string) ([]string, error) {
+	partialKey, err := stub.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, key := range stub.keys() {
+		if strings.HasPrefix(key, partialKey) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (stub *fakeStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	return stub.iterator(stub.rangeKeys(startKey, endKey)), nil
+}
+
+func (stub *fakeStub) GetStateByPartialCompositeKey(objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+	keys, err := stub.compositeKeys(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	return stub.iterator(keys), nil
+}
+
+func (stub *fakeStub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	keys, metadata := page(stub.rangeKeys(startKey, endKey), pageSize, bookmark)
+	return stub.iterator(keys), metadata, nil
+}
+
+func (stub *fakeStub) GetStateByPartialCompositeKeyWithPagination(objectType string, attributes []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	keys, err := stub.compositeKeys(objectType, attributes)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, metadata := page(keys, pageSize, bookmark)
+	return stub.iterator(keys), metadata, nil
+}
+
+// GetQueryResult stands in for CouchDB. Like CouchDB it matches the selector against every JSON document
+// in the namespace, including those stored under composite keys, and supports field equality, $eq, $gt,
+// $gte, $lt, $lte and $and.
+func (stub *fakeStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	keys, err := stub.queryKeys(query)
+	if err != nil {
+		return nil, err
+	}
+	return stub.iterator(keys), nil
+}
+
+func (stub *fakeStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	keys, err := stub.queryKeys(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, metadata := page(keys, pageSize, bookmark)
+	return stub.iterator(keys), metadata, nil
+}
+
+// queryKeys returns the keys of the documents matching the selector of a CouchDB query string
+func (stub *fakeStub) queryKeys(query string) ([]string, error) {
+	var parsed struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	err := json.Unmarshal([]byte(query), &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %v", err)
+	}
+
+	var keys []string
+	for _, key := range stub.keys() {
+		var doc map[string]interface{}
+		if json.Unmarshal(stub.State[key], &doc) != nil {
+			continue
+		}
+		match, err := matchSelector(doc, parsed.Selector)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// matchSelector reports whether the document matches every condition of the selector
+func matchSelector(doc map[string]interface{}, selector map[string]interface{}) (bool, error) {
+	for field, condition := range selector {
+		if field == "$and" {
+			clauses, ok := condition.([]interface{})
+			if !ok {
+				return false, fmt.Errorf("$and takes an array")
+			}
+			for _, clause := range clauses {
+				subSelector, ok := clause.(map[string]interface{})
+				if !ok {
+					return false, fmt.Errorf("$and takes an array of selectors")
+				}
+				match, err := matchSelector(doc, subSelector)
+				if err != nil || !match {
+					return false, err
+				}
+			}
+			continue
+		}
+
+		value, found := doc[field]
+		operators, ok := condition.(map[string]interface{})
+		if !ok {
+			operators = map[string]interface{}{"$eq": condition}
+		}
+		for operator, operand := range operators {
+			if !found {
+				return false, nil
+			}
+			match, err := compareValues(operator, value, operand)
+			if err != nil || !match {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// compareValues applies a comparison operator to two numbers or two strings
+func compareValues(operator string, value, operand interface{}) (bool, error) {
+	var cmp int
+	switch v := value.(type) {
+	case float64:
+		o, ok := operand.(float64)
+		if !ok {
+			return false, nil
+		}
+		switch {
+		case v < o:
+			cmp = -1
+		case v > o:
+			cmp = 1
+		}
+	case string:
+		o, ok := operand.(string)
+		if !ok {
+			return false, nil
+		}
+		cmp = strings.Compare(v, o)
+	default:
+		return false, nil
+	}
+
+	switch operator {
+	case "$eq":
+		return cmp == 0, nil
+	case "$gt":
+		return cmp > 0, nil
+	case "$gte":
+		return cmp >= 0, nil
+	case "$lt":
+		return cmp < 0, nil
+	case "$lte":
+		return cmp <= 0, nil
+	}
+	return false, fmt.Errorf("unsupported operator %s", operator)
+}
+
+// page returns up to pageSize keys starting from the bookmark, which like a peer's is the first key of
+// the page. The returned bookmark is the first key of the next page, or empty after the last page.
+func page(keys []string, pageSize int32, bookmark string) ([]string, *peer.QueryResponseMetadata) {
+	start := 0
+	for start < len(keys) && keys[start] < bookmark {
+		start++
+	}
+	end := start + int(pageSize)
+	if end > len(keys) {
+		end = len(keys)
+	}
+
+	metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(end - start)}
+	if end < len(keys) {
+		metadata.Bookmark = keys[end]
+	}
+	return keys[start:end], metadata
+}
+
+// iterator returns an iterator over the given keys and their current values
+func (stub *fakeStub) iterator(keys []string) *fakeIterator {
+	results := make([]*queryresult.KV, 0, len(keys))
+	for _, key := range keys {
+		results = append(results, &queryresult.KV{Namespace: stub.Name, Key: key, Value: stub.State[key]})
+	}
+	return &fakeIterator{results: results}
+}
+
+// fakeIterator iterates over a fixed list of query results
+type fakeIterator struct {
+	results []*queryresult.KV
+	next    int
+}
+
+func (it *fakeIterator) HasNext() bool {
+	return it.next < len(it.results)
+}
+
+func (it *fakeIterator) Next() (*queryresult.KV, error) {
+	if !it.HasNext() {
+		return nil, fmt.Errorf("no more results")
+	}
+	it.next++
+	return it.results[it.next-1], nil
+}
+
+func (it *fakeIterator) Close() error {
+	return nil
+}
+
+// fakeHistoryIterator iterates over a fixed list of key modifications
+type fakeHistoryIterator struct {
+	results []*queryresult.KeyModification
+	next    int
+}
+
+func (it *fakeHistoryIterator) HasNext() bool {
+	return it.next < len(it.results)
+}
+
+func (it *fakeHistoryIterator) Next() (*queryresult.KeyModification, error) {
+	if !it.HasNext() {
+		return nil, fmt.Errorf("no more results")
+	}
+	it.next++
+	return it.results[it.next-1], nil
+}
+
+func (it *fakeHistoryIterator) Close() error {
+	return nil
+}
+
+// putJSON writes a value to world state outside of any contract function, as an earlier
+// chaincode version would have
+func putJSON(t *testing.T, stub *fakeStub, key string, value interface{}) {
+	t.Helper()
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionStart("setup")
+	err = stub.PutState(key, valueJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectCode fails the test unless err is a chaincode error with the given code
+func expectCode(t *testing.T, err error, code string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected a %s error, got none", code)
+	}
+	if !strings.HasPrefix(err.Error(), "["+code+"]") {
+		t.Fatalf("expected a %s error, got %v", code, err)
+	}
+}
+
+// expectEvent fails the test unless the last transaction emitted the named event, and returns its payload
+func expectEvent(t *testing.T, stub *fakeStub, name string) AssetEvent {
+	t.Helper()
+	if stub.lastEvent != name {
+		t.Fatalf("expected event %s, got %q", name, stub.lastEvent)
+	}
+	var event AssetEvent
+	if err := json.Unmarshal(stub.lastEventPayload, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Version != AssetEventVersion || event.TxID != stub.TxID {
+		t.Fatalf("event %s has version %d and transaction %s, expected %d and %s", name, event.Version, event.TxID, AssetEventVersion, stub.TxID)
+	}
+	return event
+}
+
+// expectHistory fails the test unless the asset's history records the actions and owners in order
+func expectHistory(t *testing.T, stub *fakeStub, assetID string, entries ...[2]string) {
+	t.Helper()
+	// Read outside of a transaction, so the last transaction's event is kept
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(bankUser)
+	history, err := new(SmartContract).GetAssetHistory(ctx, assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][2]string
+	for _, entry := range history {
+		got = append(got, [2]string{entry.Action, entry.Owner})
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Fatalf("expected history %v of %s, got %v", entries, assetID, got)
+	}
+}
+
+// snapshot copies the world state so a test can check that a transaction left it unchanged
+func (stub *fakeStub) snapshot() map[string]string {
+	state := make(map[string]string, len(stub.State))
+	for key, value := range stub.State {
+		state[key] = string(value)
+	}
+	return state
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Transient map keys carrying the W3C trace context of the API request that created the proposal
+const (
+	traceparentKey = "traceparent"
+	tracestateKey  = "tracestate"
+)
+
+// logTraceContext runs before every transaction and logs the trace context passed in the transient map,
+// so the chaincode logs of a transaction can be found from the API's trace. Transactions without a
+// trace context are not logged, and a transaction never fails because of its trace context.
+func logTraceContext(ctx contractapi.TransactionContextInterface) error {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		log.Printf("Failed to read trace context of transaction %s: %v", ctx.GetStub().GetTxID(), err)
+		return nil
+	}
+
+	traceparent, ok := transientMap[traceparentKey]
+	if !ok {
+		return nil
+	}
+
+	function, _ := ctx.GetStub().GetFunctionAndParameters()
+	if tracestate := transientMap[tracestateKey]; len(tracestate) > 0 {
+		log.Printf("Transaction %s (%s) traceparent=%s tracestate=%s", ctx.GetStub().GetTxID(), function, traceparent, tracestate)
+	} else {
+		log.Printf("Transaction %s (%s) traceparent=%s", ctx.GetStub().GetTxID(), function, traceparent)
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ CC_INIT_FCN=${7:-""}
 DELAY=${8:-"3"}
 MAX_RETRY=${9:-"5"}
 VERBOSE=${10:-"false"}
+CC_COLL_CONFIG=${11:-"../chaincode/collections_config.json"}
 
 . scripts/utils.sh
 
@@ -90,7 +91,7 @@ approveForMyOrg() {
   infoln "Approving chaincode for ${ORG}..."
 
   set -x
-  peer lifecycle chaincode approveformyorg -o orderer.myindo.com:7050 --ordererTLSHostnameOverride orderer.myindo.com --tls --cafile $ORDERER_CA --channelID $CHANNEL_NAME --name ${CC_NAME} --version ${CC_VERSION} --package-id ${PACKAGE_ID} --sequence ${CC_SEQUENCE} ${INIT_REQUIRED}
+  peer lifecycle chaincode approveformyorg -o orderer.myindo.com:7050 --ordererTLSHostnameOverride orderer.myindo.com --tls --cafile $ORDERER_CA --channelID $CHANNEL_NAME --name ${CC_NAME} --version ${CC_VERSION} --package-id ${PACKAGE_ID} --sequence ${CC_SEQUENCE} ${INIT_REQUIRED} ${CC_COLL_CONFIG_FLAG}
   { set +x; } 2>/dev/null
   res=$?
   verifyResult $res "Chaincode definition approval on peer0.${ORG} has failed"
@@ -111,7 +112,7 @@ checkCommitReadiness() {
     sleep $DELAY
     infoln "Attempting to check the commit readiness of the chaincode definition on peer0.${ORG}, Retry after $DELAY seconds."
     set -x
-    peer lifecycle chaincode checkcommitreadiness --channelID $CHANNEL_NAME --name ${CC_NAME} --version ${CC_VERSION} --sequence ${CC_SEQUENCE} ${INIT_REQUIRED} --output json
+    peer lifecycle chaincode checkcommitreadiness --channelID $CHANNEL_NAME --name ${CC_NAME} --version ${CC_VERSION} --sequence ${CC_SEQUENCE} ${INIT_REQUIRED} ${CC_COLL_CONFIG_FLAG} --output json
     { set +x; } 2>/dev/null
     res=$?
     let rc=$res
@@ -135,7 +136,7 @@ commitChaincodeDefinition() {
   while [ $res -ne 0 -a $COUNTER -lt $MAX_RETRY ]; do
     infoln "Attempting to commit chaincode definition on ${CHANNEL_NAME}, Retry after $DELAY seconds."
     set -x
-    peer lifecycle chaincode commit -o orderer.myindo.com:7050 --ordererTLSHostnameOverride orderer.myindo.com --tls --cafile $ORDERER_CA --channelID $CHANNEL_NAME --name ${CC_NAME} $PEER_CONN_PARMS --version ${CC_VERSION} --sequence ${CC_SEQUENCE} ${INIT_REQUIRED}
+    peer lifecycle chaincode commit -o orderer.myindo.com:7050 --ordererTLSHostnameOverride orderer.myindo.com --tls --cafile $ORDERER_CA --channelID $CHANNEL_NAME --name ${CC_NAME} $PEER_CONN_PARMS --version ${CC_VERSION} --sequence ${CC_SEQUENCE} ${INIT_REQUIRED} ${CC_COLL_CONFIG_FLAG}
     { set +x; } 2>/dev/null
     res=$?
     let rc=$res
@@ -208,6 +209,13 @@ else
   INIT_REQUIRED="--init-required"
 fi
 
+# Set private data collection flag
+if [ "$CC_COLL_CONFIG" = "" ]; then
+  CC_COLL_CONFIG_FLAG=""
+else
+  CC_COLL_CONFIG_FLAG="--collections-config $CC_COLL_CONFIG"
+fi
+
 # Main execution
 infoln "Starting chaincode deployment..."
 
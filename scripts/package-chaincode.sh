@@ -8,7 +8,7 @@ echo "Packaging chaincode..."
 cd "$(dirname "$0")/../chaincode"
 
 # Create the chaincode package
-tar -czf basic.tar.gz chaincode.go go.mod go.sum
+tar -czf basic.tar.gz *.go go.mod go.sum META-INF
 
 if [ $? -ne 0 ]; then
     echo "Failed to package chaincode"
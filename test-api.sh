@@ -5,6 +5,12 @@ echo "===================================="
 
 BASE_URL="http://localhost:8080"
 
+# Bearer token for the API; see "Authentication" in README.md
+AUTH=()
+if [ -n "$API_TOKEN" ]; then
+    AUTH=(-H "Authorization: Bearer $API_TOKEN")
+fi
+
 # Function to test endpoint
 test_endpoint() {
     local method=$1
@@ -16,13 +22,13 @@ test_endpoint() {
     echo "Request: $method $endpoint"
 
     if [ "$method" = "GET" ]; then
-        response=$(curl -s -w "\nHTTP_CODE:%{http_code}" "$BASE_URL$endpoint")
+        response=$(curl -s -w "\nHTTP_CODE:%{http_code}" "${AUTH[@]}" "$BASE_URL$endpoint")
     elif [ "$method" = "POST" ]; then
-        response=$(curl -s -w "\nHTTP_CODE:%{http_code}" -X POST -H "Content-Type: application/json" -d "$data" "$BASE_URL$endpoint")
+        response=$(curl -s -w "\nHTTP_CODE:%{http_code}" "${AUTH[@]}" -X POST -H "Content-Type: application/json" -d "$data" "$BASE_URL$endpoint")
     elif [ "$method" = "PUT" ]; then
-        response=$(curl -s -w "\nHTTP_CODE:%{http_code}" -X PUT -H "Content-Type: application/json" -d "$data" "$BASE_URL$endpoint")
+        response=$(curl -s -w "\nHTTP_CODE:%{http_code}" "${AUTH[@]}" -X PUT -H "Content-Type: application/json" -d "$data" "$BASE_URL$endpoint")
     elif [ "$method" = "DELETE" ]; then
-        response=$(curl -s -w "\nHTTP_CODE:%{http_code}" -X DELETE "$BASE_URL$endpoint")
+        response=$(curl -s -w "\nHTTP_CODE:%{http_code}" "${AUTH[@]}" -X DELETE "$BASE_URL$endpoint")
     fi
 
     http_code=$(echo "$response" | tail -n1 | cut -d: -f2)
@@ -68,7 +74,7 @@ test_endpoint "GET" "/api/v1/assets/test-asset-001" "" "Get Specific Asset"
 test_endpoint "PUT" "/api/v1/assets/test-asset-001" '{"color":"orange","size":20,"owner":"UpdatedUser","appraisedValue":800}' "Update Asset"
 
 # Test 7: Transfer Asset
-test_endpoint "POST" "/api/v1/assets/test-asset-001/transfer" '{"newOwner":"NewOwner"}' "Transfer Asset"
+test_endpoint "POST" "/api/v1/assets/test-asset-001/transfer" '{"newOwner":"NewOwner","newOwnerMSP":"Org1MSP","newOwnerIdentity":"x509::CN=newowner,OU=client::CN=ca.org1.example.com"}' "Transfer Asset"
 
 # Test 8: Get Updated Asset
 test_endpoint "GET" "/api/v1/assets/test-asset-001" "" "Get Updated Asset"